@@ -85,21 +85,25 @@ func initConfig() {
 
 func getConfig() (config.Config, error) {
 	cfg := config.Config{
-		PartitionID:                       viper.GetString("server.partition"),
-		ClusterID:                         viper.GetString("clusterID"),
-		ServerEC2DescribeInstancesRoleARN: viper.GetString("server.ec2DescribeInstancesRoleARN"),
-		HostPort:                          viper.GetInt("server.port"),
-		Hostname:                          viper.GetString("server.hostname"),
-		GenerateKubeconfigPath:            viper.GetString("server.generateKubeconfig"),
-		KubeconfigPregenerated:            viper.GetBool("server.kubeconfigPregenerated"),
-		StateDir:                          viper.GetString("server.stateDir"),
-		Address:                           viper.GetString("server.address"),
-		Kubeconfig:                        viper.GetString("server.kubeconfig"),
-		Master:                            viper.GetString("server.master"),
-		BackendMode:                       viper.GetStringSlice("server.backendMode"),
-		EC2DescribeInstancesQps:           viper.GetInt("server.ec2DescribeInstancesQps"),
-		EC2DescribeInstancesBurst:         viper.GetInt("server.ec2DescribeInstancesBurst"),
-		ScrubbedAWSAccounts:               viper.GetStringSlice("server.scrubbedAccounts"),
+		PartitionID:                           viper.GetString("server.partition"),
+		ClusterID:                             viper.GetString("clusterID"),
+		ServerEC2DescribeInstancesRoleARN:     viper.GetString("server.ec2DescribeInstancesRoleARN"),
+		HostPort:                              viper.GetInt("server.port"),
+		Hostname:                              viper.GetString("server.hostname"),
+		GenerateKubeconfigPath:                viper.GetString("server.generateKubeconfig"),
+		KubeconfigPregenerated:                viper.GetBool("server.kubeconfigPregenerated"),
+		StateDir:                              viper.GetString("server.stateDir"),
+		Address:                               viper.GetString("server.address"),
+		Kubeconfig:                            viper.GetString("server.kubeconfig"),
+		Master:                                viper.GetString("server.master"),
+		BackendMode:                           viper.GetStringSlice("server.backendMode"),
+		EC2DescribeInstancesQps:               viper.GetInt("server.ec2DescribeInstancesQps"),
+		EC2DescribeInstancesBurst:             viper.GetInt("server.ec2DescribeInstancesBurst"),
+		EC2DescribeInstancesBatchIdleInterval: viper.GetDuration("server.ec2DescribeInstancesBatchIdleInterval"),
+		ScrubbedAWSAccounts:                   viper.GetStringSlice("server.scrubbedAccounts"),
+		STSAllowedHostsFile:                   viper.GetString("server.stsAllowedHostsFile"),
+		STSAllowUnlistedRegions:               viper.GetBool("server.stsAllowUnlistedRegions"),
+		STSRegion:                             viper.GetString("server.stsRegion"),
 	}
 	if err := viper.UnmarshalKey("server.mapRoles", &cfg.RoleMappings); err != nil {
 		return cfg, fmt.Errorf("invalid server role mappings: %v", err)
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 
 	"k8s.io/sample-controller/pkg/signals"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/mapper"
@@ -37,6 +38,8 @@ const (
 	// Default Ec2 TPS Variables
 	DefaultEC2DescribeInstancesQps   = 15
 	DefaultEC2DescribeInstancesBurst = 5
+	// Default time to wait for more instance ids before a partial ec2:DescribeInstances batch
+	DefaultEC2DescribeInstancesBatchIdleInterval = 20 * time.Millisecond
 )
 
 // serverCmd represents the server command
@@ -128,6 +131,30 @@ func init() {
 		"AWS EC2 rate Limiting with burst")
 	viper.BindPFlag("server.ec2DescribeInstancesBurst", serverCmd.Flags().Lookup("ec2-describeInstances-burst"))
 
+	serverCmd.Flags().Duration(
+		"ec2-describeInstances-batch-idle-interval",
+		DefaultEC2DescribeInstancesBatchIdleInterval,
+		"Time to wait for more instance ids before making a batched AWS EC2 DescribeInstances call with fewer instances than the batch size")
+	viper.BindPFlag("server.ec2DescribeInstancesBatchIdleInterval", serverCmd.Flags().Lookup("ec2-describeInstances-batch-idle-interval"))
+
+	serverCmd.Flags().String(
+		"sts-allowed-hosts-file",
+		"",
+		"Optional `path` to a YAML file of additional STS hostnames, keyed by partition, that are accepted in tokens")
+	viper.BindPFlag("server.stsAllowedHostsFile", serverCmd.Flags().Lookup("sts-allowed-hosts-file"))
+
+	serverCmd.Flags().Bool(
+		"sts-allow-unlisted-regions",
+		false,
+		"Accept tokens for the regional STS endpoints of regions this release doesn't list in the partition, such as newly enabled opt-in regions")
+	viper.BindPFlag("server.stsAllowUnlistedRegions", serverCmd.Flags().Lookup("sts-allow-unlisted-regions"))
+
+	serverCmd.Flags().String(
+		"sts-region",
+		"",
+		"Only accept tokens for the STS endpoint of this `region`, typically the cluster's, instead of any region in the partition")
+	viper.BindPFlag("server.stsRegion", serverCmd.Flags().Lookup("sts-region"))
+
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 	_ = fs.Parse([]string{})
 	flag.CommandLine = fs
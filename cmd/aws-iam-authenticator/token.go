@@ -53,6 +53,13 @@ var tokenCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if !tokenOnly {
+			if err := token.ValidateExecConfig(clusterID, os.Getenv("KUBERNETES_EXEC_INFO")); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		var tok token.Token
 		var out string
 		var err error
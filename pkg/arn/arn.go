@@ -14,8 +14,13 @@ import (
 //   * AWS account: arn:aws:iam::123456789012:root
 //   * IAM user: arn:aws:iam::123456789012:user/Bob
 //   * IAM role: arn:aws:iam::123456789012:role/S3Access
+//   * IAM role with a path: arn:aws:iam::123456789012:role/team/S3Access (converted to IAM role without the path)
 //   * IAM Assumed role: arn:aws:sts::123456789012:assumed-role/Accounting-Role/Mary (converted to IAM role)
 //   * Federated user: arn:aws:sts::123456789012:federated-user/Bob
+//
+// STS never includes the path of a role in its assumed role ARNs, so role
+// paths are dropped, making a role with a path and its assumed role
+// canonicalize to the same ARN.
 func Canonicalize(arn string) (string, error) {
 	parsed, err := awsarn.Parse(arn)
 	if err != nil {
@@ -38,15 +43,20 @@ func Canonicalize(arn string) (string, error) {
 			if len(parts) < 3 {
 				return "", fmt.Errorf("assumed-role arn '%s' does not have a role", arn)
 			}
-			// IAM ARNs can contain paths, part[0] is resource, parts[len(parts)] is the SessionName.
-			role := strings.Join(parts[1:len(parts)-1], "/")
-			return fmt.Sprintf("arn:%s:iam::%s:role/%s", parsed.Partition, parsed.AccountID, role), nil
+			// part[0] is resource, parts[len(parts)-1] is the SessionName and the role name is right before it.
+			return roleARN(parsed, parts[len(parts)-2]), nil
 		default:
 			return "", fmt.Errorf("unrecognized resource %s for service sts", parsed.Resource)
 		}
 	case "iam":
 		switch resource {
-		case "role", "user", "root":
+		case "role":
+			if len(parts) > 2 {
+				// drop the path, the role name is the last part
+				return roleARN(parsed, parts[len(parts)-1]), nil
+			}
+			return arn, nil
+		case "user", "root":
 			return arn, nil
 		default:
 			return "", fmt.Errorf("unrecognized resource %s for service iam", parsed.Resource)
@@ -56,6 +66,25 @@ func Canonicalize(arn string) (string, error) {
 	return "", fmt.Errorf("service %s in arn %s is not a valid service for identities", parsed.Service, arn)
 }
 
+// CanonicalizeForPartition canonicalizes arn like Canonicalize, but returns
+// an error if the ARN isn't in the partition partitionID.
+func CanonicalizeForPartition(arn, partitionID string) (string, error) {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return "", fmt.Errorf("arn '%s' is invalid: '%v'", arn, err)
+	}
+	if parsed.Partition != partitionID {
+		return "", fmt.Errorf("arn '%s' is in partition %s, expected %s", arn, parsed.Partition, partitionID)
+	}
+	return Canonicalize(arn)
+}
+
+// roleARN returns the ARN of the IAM role named role, without a path, in the
+// partition and account of parsed.
+func roleARN(parsed awsarn.ARN, role string) string {
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parsed.Partition, parsed.AccountID, role)
+}
+
 func checkPartition(partition string) error {
 	partitions := []string{"aws", "aws-cn", "aws-us-gov", "aws-iso", "aws-iso-b"}
 	for _, p := range partitions {
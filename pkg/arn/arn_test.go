@@ -16,7 +16,12 @@ var arnTests = []struct {
 	{"arn:aws:sts::123456789012:assumed-role/Admin/Session", "arn:aws:iam::123456789012:role/Admin", nil},
 	{"arn:aws:sts::123456789012:federated-user/Bob", "arn:aws:sts::123456789012:federated-user/Bob", nil},
 	{"arn:aws:iam::123456789012:root", "arn:aws:iam::123456789012:root", nil},
-	{"arn:aws:sts::123456789012:assumed-role/Org/Team/Admin/Session", "arn:aws:iam::123456789012:role/Org/Team/Admin", nil},
+	{"arn:aws:sts::123456789012:assumed-role/Org/Team/Admin/Session", "arn:aws:iam::123456789012:role/Admin", nil},
+	{"arn:aws:iam::123456789012:role/team/app-role", "arn:aws:iam::123456789012:role/app-role", nil},
+	{"arn:aws:iam::123456789012:role/org/team/app-role", "arn:aws:iam::123456789012:role/app-role", nil},
+	{"arn:aws:sts::123456789012:assumed-role/app-role/Session", "arn:aws:iam::123456789012:role/app-role", nil},
+	{"arn:aws:sts::123456789012:assumed-role/eks-node-role/i-0123456789abcdef0", "arn:aws:iam::123456789012:role/eks-node-role", nil},
+	{"arn:aws:iam::123456789012:instance-profile/eks-node-profile", "", fmt.Errorf("unrecognized resource")},
 	{"arn:aws-iso:iam::123456789012:user/Chris", "arn:aws-iso:iam::123456789012:user/Chris", nil},
 	{"arn:aws-iso-b:iam::123456789012:user/Chris", "arn:aws-iso-b:iam::123456789012:user/Chris", nil},
 }
@@ -33,3 +38,28 @@ func TestUserARN(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonicalizeForPartition(t *testing.T) {
+	tests := []struct {
+		arn       string
+		partition string
+		expected  string
+		err       bool
+	}{
+		{"arn:aws:sts::123456789012:assumed-role/Admin/Session", "aws", "arn:aws:iam::123456789012:role/Admin", false},
+		{"arn:aws-cn:iam::123456789012:user/Alice", "aws-cn", "arn:aws-cn:iam::123456789012:user/Alice", false},
+		{"arn:aws-cn:iam::123456789012:user/Alice", "aws", "", true},
+		{"arn:aws:sts::123456789012:assumed-role/Admin/Session", "aws-us-gov", "", true},
+		{"NOT AN ARN", "aws", "", true},
+	}
+	for _, tc := range tests {
+		actual, err := CanonicalizeForPartition(tc.arn, tc.partition)
+		if (err != nil) != tc.err {
+			t.Errorf("CanonicalizeForPartition(%s, %s) expected err: %v, actual err: %v", tc.arn, tc.partition, tc.err, err)
+			continue
+		}
+		if actual != tc.expected {
+			t.Errorf("CanonicalizeForPartition(%s, %s) expected: %s, actual: %s", tc.arn, tc.partition, tc.expected, actual)
+		}
+	}
+}
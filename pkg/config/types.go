@@ -16,6 +16,8 @@ limitations under the License.
 
 package config
 
+import "time"
+
 type IdentityMapping struct {
 	IdentityARN string
 
@@ -32,8 +34,8 @@ type IdentityMapping struct {
 // list of Kubernetes groups. The username and groups are specified as templates
 // that may optionally contain two template parameters:
 //
-//  1) "{{AccountID}}" is the 12 digit AWS ID.
-//  2) "{{SessionName}}" is the role session name.
+//  1. "{{AccountID}}" is the 12 digit AWS ID.
+//  2. "{{SessionName}}" is the role session name.
 //
 // The meaning of SessionName depends on the type of entity assuming the role.
 // In the case of an EC2 instance role this will be the EC2 instance ID. In the
@@ -142,4 +144,22 @@ type Config struct {
 	// understand we don't need to change
 	EC2DescribeInstancesQps   int
 	EC2DescribeInstancesBurst int
+
+	// EC2DescribeInstancesBatchIdleInterval is how long to wait for more instance ids before
+	// making a batched ec2:DescribeInstances call with fewer instances than the batch size.
+	EC2DescribeInstancesBatchIdleInterval time.Duration
+
+	// STSAllowedHostsFile is an optional path to a YAML file of additional STS hostnames,
+	// keyed by partition, that are accepted in tokens.
+	// +optional
+	STSAllowedHostsFile string
+
+	// STSAllowUnlistedRegions accepts the regional STS hostnames of regions missing
+	// from the partition's region list, such as newly enabled opt-in regions.
+	STSAllowUnlistedRegions bool
+
+	// STSRegion, if set, only accepts tokens for the STS endpoint of this region,
+	// rather than of any region in the partition.
+	// +optional
+	STSRegion string
 }
@@ -34,6 +34,9 @@ const (
 	// Maximum time in Milliseconds to wait for a new batch call this also depends on if the instance size has
 	// already become 100 then it will not respect this limit
 	maxWaitIntervalForBatch = 200
+	// default time to wait for more instance ids before making a batch call with fewer than
+	// maxInstancesBatchSize instances
+	defaultBatchIdleInterval = 20 * time.Millisecond
 )
 
 // Get a node name from instance ID
@@ -61,9 +64,12 @@ type ec2ProviderImpl struct {
 	privateDNSCache    ec2PrivateDNSCache
 	ec2Requests        ec2Requests
 	instanceIdsChannel chan string
+	batchIdleInterval  time.Duration
 }
 
-func New(roleARN string, qps int, burst int) EC2Provider {
+// New creates an EC2Provider. Batched ec2:DescribeInstances calls are made once no new instance
+// id has been queued for batchIdleInterval, or defaultBatchIdleInterval if it is not positive.
+func New(roleARN string, qps int, burst int, batchIdleInterval time.Duration) EC2Provider {
 	dnsCache := ec2PrivateDNSCache{
 		cache: make(map[string]string),
 		lock:  sync.RWMutex{},
@@ -77,6 +83,7 @@ func New(roleARN string, qps int, burst int) EC2Provider {
 		privateDNSCache:    dnsCache,
 		ec2Requests:        ec2Requests,
 		instanceIdsChannel: make(chan string, maxChannelSize),
+		batchIdleInterval:  batchIdleInterval,
 	}
 }
 
@@ -129,10 +136,16 @@ func (p *ec2ProviderImpl) setPrivateDNSNameCache(id string, privateDNSName strin
 	p.privateDNSCache.cache[id] = privateDNSName
 }
 
-func (p *ec2ProviderImpl) setRequestInFlightForInstanceId(id string) {
+// setRequestInFlightForInstanceId marks the request for id as in flight, returning false if it
+// already was so that only one caller makes the ec2:DescribeInstances call for it.
+func (p *ec2ProviderImpl) setRequestInFlightForInstanceId(id string) bool {
 	p.ec2Requests.lock.Lock()
 	defer p.ec2Requests.lock.Unlock()
+	if p.ec2Requests.set[id] {
+		return false
+	}
 	p.ec2Requests.set[id] = true
+	return true
 }
 
 func (p *ec2ProviderImpl) unsetRequestInFlightForInstanceId(id string) {
@@ -141,13 +154,6 @@ func (p *ec2ProviderImpl) unsetRequestInFlightForInstanceId(id string) {
 	delete(p.ec2Requests.set, id)
 }
 
-func (p *ec2ProviderImpl) getRequestInFlightForInstanceId(id string) bool {
-	p.ec2Requests.lock.RLock()
-	defer p.ec2Requests.lock.RUnlock()
-	_, ok := p.ec2Requests.set[id]
-	return ok
-}
-
 func (p *ec2ProviderImpl) getRequestInFlightSize() int {
 	p.ec2Requests.lock.RLock()
 	defer p.ec2Requests.lock.RUnlock()
@@ -173,8 +179,9 @@ func (p *ec2ProviderImpl) GetPrivateDNSName(id string) (string, error) {
 		return privateDNSName, nil
 	}
 	logrus.Debugf("Missed the cache for the InstanceId = %s Verifying if its already in requestQueue ", id)
-	// check if the request for instanceId already in queue.
-	if p.getRequestInFlightForInstanceId(id) {
+	// check if the request for instanceId already in queue, adding it otherwise so that
+	// concurrent lookups of the same instanceId share a single ec2:DescribeInstances call.
+	if !p.setRequestInFlightForInstanceId(id) {
 		logrus.Debugf("Found the InstanceId:= %s request In Queue waiting in 5 seconds loop ", id)
 		for i := 0; i < totalIterationForWaitInterval; i++ {
 			time.Sleep(defaultWaitInterval)
@@ -186,7 +193,11 @@ func (p *ec2ProviderImpl) GetPrivateDNSName(id string) (string, error) {
 		return "", fmt.Errorf("failed to find node %s in PrivateDNSNameCache returning from loop", id)
 	}
 	logrus.Debugf("Missed the requestQueue cache for the InstanceId = %s", id)
-	p.setRequestInFlightForInstanceId(id)
+	// a request for the same instanceId may have completed since we checked the cache
+	if privateDNSName, err := p.getPrivateDNSNameCache(id); err == nil {
+		p.unsetRequestInFlightForInstanceId(id)
+		return privateDNSName, nil
+	}
 	requestQueueLength := p.getRequestInFlightSize()
 	// The code verifies if the requestQuqueMap size is greater than max request in flight with rate
 	// limiting then writes to the channel where we are making batch ec2:DescribeInstances API call.
@@ -221,8 +232,23 @@ func (p *ec2ProviderImpl) GetPrivateDNSName(id string) (string, error) {
 	return privateDNSName, nil
 }
 
+// getBatchIdleInterval returns how long to wait for more instance ids before
+// making a batch call.
+func (p *ec2ProviderImpl) getBatchIdleInterval() time.Duration {
+	if p.batchIdleInterval <= 0 {
+		return defaultBatchIdleInterval
+	}
+	return p.batchIdleInterval
+}
+
 func (p *ec2ProviderImpl) StartEc2DescribeBatchProcessing() {
+	idleInterval := p.getBatchIdleInterval()
+	pollInterval := 20 * time.Millisecond
+	if idleInterval < pollInterval {
+		pollInterval = idleInterval
+	}
 	startTime := time.Now()
+	lastReceivedTime := startTime
 	var instanceIdList []string
 	for {
 		var instanceId string
@@ -230,22 +256,25 @@ func (p *ec2ProviderImpl) StartEc2DescribeBatchProcessing() {
 		case instanceId = <-p.instanceIdsChannel:
 			logrus.Debugf("Received the Instance Id := %s from buffered Channel for batch processing ", instanceId)
 			instanceIdList = append(instanceIdList, instanceId)
+			lastReceivedTime = time.Now()
 		default:
 			// Waiting for more elements to get added to the buffered Channel
 			// And to support the for select loop.
-			time.Sleep(20 * time.Millisecond)
+			time.Sleep(pollInterval)
 		}
 		endTime := time.Now()
 		/*
 			The if statement checks for empty list and ignores to make any ec2:Describe API call
 			If elements are less than 100 and time of 200 millisecond has elapsed it will make the
 			ec2:DescribeInstances call with as many elements in the list.
+			It also makes the call as soon as no new element has been received for the idle interval,
+			so that a few sparse lookups don't wait out the whole 200 milliseconds.
 			It is also possible that if the system gets more than 99 elements in the list in less than
 			200 milliseconds time it will the ec2:DescribeInstances call and that's our whole point of
 			optimization here. Also for FYI we have client level rate limiting which is what this
 			ec2:DescribeInstances call will make so this call is also rate limited.
 		*/
-		if (len(instanceIdList) > 0 && (endTime.Sub(startTime).Milliseconds()) > maxWaitIntervalForBatch) || len(instanceIdList) > maxInstancesBatchSize {
+		if (len(instanceIdList) > 0 && ((endTime.Sub(startTime).Milliseconds()) > maxWaitIntervalForBatch || endTime.Sub(lastReceivedTime) >= idleInterval)) || len(instanceIdList) > maxInstancesBatchSize {
 			startTime = time.Now()
 			dupInstanceList := make([]string, len(instanceIdList))
 			copy(dupInstanceList, instanceIdList)
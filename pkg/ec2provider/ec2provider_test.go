@@ -4,6 +4,7 @@ import (
 	"context"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,9 +20,11 @@ const (
 type mockEc2Client struct {
 	EC2API
 	Reservations []*ec2Types.Reservation
+	calls        int32
 }
 
-func (c mockEc2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+func (c *mockEc2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	atomic.AddInt32(&c.calls, 1)
 	// simulate the time it takes for aws to return
 	time.Sleep(DescribeDelay * time.Millisecond)
 	var reservations []ec2Types.Reservation
@@ -73,6 +76,44 @@ func TestGetPrivateDNSName(t *testing.T) {
 	}
 }
 
+func TestGetPrivateDNSNameFlushesIdleBatch(t *testing.T) {
+	ec2Provider := newMockedEC2ProviderImpl()
+	ec2Provider.ec2 = &mockEc2Client{Reservations: prepareSingleInstanceOutput()}
+	// Fill up the in flight requests so that the lookup goes through batching
+	for i := 0; i < maxAllowedInflightRequest; i++ {
+		ec2Provider.setRequestInFlightForInstanceId("in-flight-" + strconv.Itoa(i))
+	}
+	go ec2Provider.StartEc2DescribeBatchProcessing()
+	start := time.Now()
+	dnsName, err := ec2Provider.GetPrivateDNSName("ec2-1")
+	if err != nil {
+		t.Error("There is an error which is not expected when calling ec2 API with setting up mocks")
+	}
+	if dnsName != "ec2-dns-1" {
+		t.Errorf("want: %v, got: %v", "ec2-dns-1", dnsName)
+	}
+	// Without flushing on idle the lone instance id would wait out the whole batch window
+	if elapsed := time.Since(start); elapsed >= (maxWaitIntervalForBatch+DescribeDelay)*time.Millisecond {
+		t.Errorf("want the batch to be flushed after %v idle, took %v", defaultBatchIdleInterval, elapsed)
+	}
+}
+
+func TestGetPrivateDNSNameConcurrentSameInstance(t *testing.T) {
+	ec2Provider := newMockedEC2ProviderImpl()
+	client := &mockEc2Client{Reservations: prepareSingleInstanceOutput()}
+	ec2Provider.ec2 = client
+	go ec2Provider.StartEc2DescribeBatchProcessing()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go getPrivateDNSName(ec2Provider, "ec2-1", "ec2-dns-1", t, &wg)
+	}
+	wg.Wait()
+	if calls := atomic.LoadInt32(&client.calls); calls != 1 {
+		t.Errorf("want: %v DescribeInstances call, got: %v", 1, calls)
+	}
+}
+
 func prepareSingleInstanceOutput() []*ec2Types.Reservation {
 	reservations := []*ec2Types.Reservation{
 		{
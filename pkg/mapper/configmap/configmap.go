@@ -18,6 +18,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/arn"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/config"
 )
 
@@ -162,7 +163,12 @@ func (ms *MapStore) saveMap(userMappings []config.UserMapping, roleMappings []co
 		ms.users[strings.ToLower(user.UserARN)] = user
 	}
 	for _, role := range roleMappings {
-		ms.roles[strings.ToLower(role.RoleARN)] = role
+		key := strings.ToLower(role.RoleARN)
+		// key roles by their canonical ARN, which has no path, like the identities they are matched against
+		if canonicalizedARN, err := arn.Canonicalize(key); err == nil {
+			key = canonicalizedARN
+		}
+		ms.roles[key] = role
 	}
 	for _, awsAccount := range awsAccounts {
 		ms.awsAccounts[awsAccount] = nil
@@ -81,6 +81,18 @@ func TestRoleMapping(t *testing.T) {
 	}
 }
 
+func TestRoleMappingWithPath(t *testing.T) {
+	ms := makeStore()
+	ms.saveMap(nil, []config.RoleMapping{{RoleARN: "arn:aws:iam::123456789012:role/team/App-Role", Username: "app"}}, nil)
+	role, err := ms.RoleMapping("arn:aws:iam::123456789012:role/app-role")
+	if err != nil {
+		t.Errorf("Could not find role with path by its canonical ARN")
+	}
+	if role.Username != "app" {
+		t.Errorf("Role for 'app-role' does not match expected value. (Actual: %+v)", role)
+	}
+}
+
 func TestAWSAccount(t *testing.T) {
 	ms := makeStore()
 	if !ms.AWSAccount("123") {
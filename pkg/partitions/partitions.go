@@ -16,13 +16,22 @@ limitations under the License.
 
 package partitions
 
-var partitionNames = []string{"aws", "aws-cn", "aws-us-gov", "aws-iso", "aws-iso-b"}
+import "sync"
 
-var partitions = map[string]interface{}{
-	"aws": map[string]interface{}{
-		"id":   "aws",
-		"name": "AWS Standard",
-		"regions": []string{
+var defaultPartitionNames = []string{"aws", "aws-cn", "aws-us-gov", "aws-iso", "aws-iso-b"}
+
+// Partition is an AWS partition and the regions it contains.
+type Partition struct {
+	ID      string
+	Name    string
+	Regions []string
+}
+
+var defaultPartitions = map[string]Partition{
+	"aws": {
+		ID:   "aws",
+		Name: "AWS Standard",
+		Regions: []string{
 			"aws-global",
 			"af-south-1",
 			"ap-east-1", "ap-northeast-1", "ap-northeast-2", "ap-south-1", "ap-southeast-1", "ap-southeast-2",
@@ -34,54 +43,111 @@ var partitions = map[string]interface{}{
 			"us-east-1-fips", "us-east-2-fips", "us-west-1-fips", "us-west-2-fips",
 		},
 	},
-	"aws-cn": map[string]interface{}{
-		"id":   "aws-cn",
-		"name": "AWS China",
-		"regions": []string{
+	"aws-cn": {
+		ID:   "aws-cn",
+		Name: "AWS China",
+		Regions: []string{
 			"cn-north-1", "cn-northwest-1",
 		},
 	},
-	"aws-us-gov": map[string]interface{}{
-		"id":   "aws-us-gov",
-		"name": "AWS GovCloud (US)",
-		"regions": []string{
+	"aws-us-gov": {
+		ID:   "aws-us-gov",
+		Name: "AWS GovCloud (US)",
+		Regions: []string{
 			"us-gov-east-1", "us-gov-west-1",
 			"us-gov-east-1-fips", "us-gov-west-1-fips",
 		},
 	},
-	"aws-iso": map[string]interface{}{
-		"id":   "aws-iso",
-		"name": "AWS ISO (US)",
-		"regions": []string{
-			"us-iso-east-1",
+	"aws-iso": {
+		ID:   "aws-iso",
+		Name: "AWS ISO (US)",
+		Regions: []string{
+			"us-iso-east-1", "us-iso-west-1",
 		},
 	},
-	"aws-iso-b": map[string]interface{}{
-		"id":   "aws-iso-b",
-		"name": "AWS ISOB (US)",
-		"regions": []string{
+	"aws-iso-b": {
+		ID:   "aws-iso-b",
+		Name: "AWS ISOB (US)",
+		Regions: []string{
 			"us-isob-east-1",
 		},
 	},
 }
 
+var (
+	// lock guards partitionNames and partitions, which may be replaced at
+	// runtime.
+	lock           sync.RWMutex
+	partitionNames []string
+	partitions     map[string]Partition
+)
+
+func init() {
+	ResetPartitions()
+}
+
+// ResetPartitions restores the built-in partitions, undoing any change made
+// to them at runtime.
+func ResetPartitions() {
+	names := append([]string(nil), defaultPartitionNames...)
+	parts := make(map[string]Partition, len(defaultPartitions))
+	for id, partition := range defaultPartitions {
+		partition.Regions = append([]string(nil), partition.Regions...)
+		parts[id] = partition
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	partitionNames = names
+	partitions = parts
+}
+
 func GetDefaultPartitionsNames() []string {
+	lock.RLock()
+	defer lock.RUnlock()
 	return partitionNames
 }
 
+// GetDefaultPartitions returns the partitions in their untyped form, keyed by
+// partition ID, with "id", "name" and "regions" entries.
 func GetDefaultPartitions() map[string]interface{} {
-	return partitions
+	lock.RLock()
+	defer lock.RUnlock()
+	result := make(map[string]interface{}, len(partitions))
+	for id, partition := range partitions {
+		result[id] = map[string]interface{}{
+			"id":      partition.ID,
+			"name":    partition.Name,
+			"regions": partition.Regions,
+		}
+	}
+	return result
 }
 
 func GetRegions(id string) []string {
-	if value, ok := partitions[id]; ok {
-		return (value.(map[string]interface{}))["regions"].([]string)
-	}
+	lock.RLock()
+	defer lock.RUnlock()
+	return partitions[id].Regions
+}
 
-	return nil
+// PartitionForRegion returns the ID of the partition listing region, and
+// whether one was found.
+func PartitionForRegion(region string) (string, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, id := range partitionNames {
+		for _, r := range partitions[id].Regions {
+			if r == region {
+				return id, true
+			}
+		}
+	}
+	return "", false
 }
 
 func ValidPartition(id string) bool {
+	lock.RLock()
+	defer lock.RUnlock()
 	_, ok := partitions[id]
 	return ok
 }
@@ -0,0 +1,104 @@
+package partitions
+
+import (
+	"testing"
+)
+
+func TestGetRegions(t *testing.T) {
+	for _, id := range GetDefaultPartitionsNames() {
+		if !ValidPartition(id) {
+			t.Errorf("partition %s should be valid", id)
+		}
+		if len(GetRegions(id)) == 0 {
+			t.Errorf("partition %s should have regions", id)
+		}
+	}
+
+	if ValidPartition("aws-not-a-partition") {
+		t.Errorf("unknown partition should not be valid")
+	}
+	if regions := GetRegions("aws-not-a-partition"); regions != nil {
+		t.Errorf("unknown partition should have no regions, got %v", regions)
+	}
+}
+
+func TestGetDefaultPartitions(t *testing.T) {
+	p := GetDefaultPartitions()["aws-cn"].(map[string]interface{})
+	if p["id"] != "aws-cn" {
+		t.Errorf("expected id to be %q but was %q", "aws-cn", p["id"])
+	}
+	if regions := p["regions"].([]string); len(regions) != 2 {
+		t.Errorf("unexpected regions %v", regions)
+	}
+}
+
+func TestGetRegionsISO(t *testing.T) {
+	cases := []struct {
+		partition string
+		region    string
+	}{
+		{"aws-iso", "us-iso-east-1"},
+		{"aws-iso", "us-iso-west-1"},
+		{"aws-iso-b", "us-isob-east-1"},
+	}
+
+	for _, c := range cases {
+		found := false
+		for _, region := range GetRegions(c.partition) {
+			if region == c.region {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("region %s not found in partition %s", c.region, c.partition)
+		}
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	cases := []struct {
+		region    string
+		partition string
+		found     bool
+	}{
+		{"us-west-2", "aws", true},
+		{"aws-global", "aws", true},
+		{"cn-northwest-1", "aws-cn", true},
+		{"us-gov-west-1-fips", "aws-us-gov", true},
+		{"us-isob-east-1", "aws-iso-b", true},
+		{"us-nowhere-1", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		partition, found := PartitionForRegion(c.region)
+		if partition != c.partition || found != c.found {
+			t.Errorf("%q: expected (%q, %t) but got (%q, %t)", c.region, c.partition, c.found, partition, found)
+		}
+	}
+}
+
+func TestResetPartitions(t *testing.T) {
+	lock.Lock()
+	partitionNames = append(partitionNames, "aws-custom")
+	partitions["aws-custom"] = Partition{ID: "aws-custom", Name: "Custom", Regions: []string{"custom-east-1"}}
+	partitions["aws"].Regions[0] = "overwritten-1"
+	lock.Unlock()
+	if !ValidPartition("aws-custom") {
+		t.Fatalf("custom partition should be valid before the reset")
+	}
+
+	ResetPartitions()
+	if ValidPartition("aws-custom") {
+		t.Errorf("custom partition should be gone after the reset")
+	}
+	if _, found := PartitionForRegion("custom-east-1"); found {
+		t.Errorf("custom region should be gone after the reset")
+	}
+	names := GetDefaultPartitionsNames()
+	if len(names) != 5 || names[len(names)-1] != "aws-iso-b" {
+		t.Errorf("unexpected partition names after the reset: %v", names)
+	}
+	if regions := GetRegions("aws"); regions[0] != "aws-global" {
+		t.Errorf("built-in regions should be restored after the reset, got %v", regions)
+	}
+}
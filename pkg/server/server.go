@@ -17,6 +17,7 @@ limitations under the License.
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -73,7 +74,19 @@ type handler struct {
 
 // metrics are handles to the collectors for prometheous for the various metrics we are tracking.
 type metrics struct {
-	latency *prometheus.HistogramVec
+	latency       *prometheus.HistogramVec
+	verifications *prometheus.CounterVec
+	stsLatency    prometheus.Histogram
+}
+
+// ObserveVerify implements token.MetricsRecorder
+func (m metrics) ObserveVerify(result string) {
+	m.verifications.WithLabelValues(result).Inc()
+}
+
+// ObserveSTSLatency implements token.MetricsRecorder
+func (m metrics) ObserveSTSLatency(latency time.Duration) {
+	m.stsLatency.Observe(latency.Seconds())
 }
 
 // namespace for the AWS IAM Authenticator's metrics
@@ -86,6 +99,9 @@ const (
 	metricSuccess   = "success"
 )
 
+// how long the readiness check waits to reach STS
+const readyzTimeout = 5 * time.Second
+
 // New the authentication webhook server.
 func New(cfg config.Config, mappers []mapper.Mapper) *Server {
 	c := &Server{
@@ -171,10 +187,29 @@ func (c *Server) getHandler(mappers []mapper.Mapper, ec2DescribeQps int, ec2Desc
 		}
 	}
 
+	var allowedHosts token.AllowedHosts
+	if c.STSAllowedHostsFile != "" {
+		var err error
+		allowedHosts, err = token.LoadAllowedHostsFromFile(c.STSAllowedHostsFile)
+		if err != nil {
+			logrus.WithError(err).Fatal("could not load STS allowed hosts")
+		}
+	}
+	m := createMetrics()
+	verifier, err := token.NewVerifierWithOptions(c.ClusterID, c.PartitionID, token.VerifierOptions{
+		AllowedHosts:         allowedHosts,
+		Metrics:              m,
+		AllowUnlistedRegions: c.STSAllowUnlistedRegions,
+		Region:               c.STSRegion,
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("could not create verifier")
+	}
+
 	h := &handler{
-		verifier:         token.NewVerifier(c.ClusterID, c.PartitionID),
-		metrics:          createMetrics(),
-		ec2Provider:      ec2provider.New(c.ServerEC2DescribeInstancesRoleARN, ec2DescribeQps, ec2DescribeBurst),
+		verifier:         verifier,
+		metrics:          m,
+		ec2Provider:      ec2provider.New(c.ServerEC2DescribeInstancesRoleARN, ec2DescribeQps, ec2DescribeBurst, c.EC2DescribeInstancesBatchIdleInterval),
 		clusterID:        c.ClusterID,
 		mappers:          mappers,
 		scrubbedAccounts: c.Config.ScrubbedAWSAccounts,
@@ -185,6 +220,7 @@ func (c *Server) getHandler(mappers []mapper.Mapper, ec2DescribeQps int, ec2Desc
 	h.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "ok")
 	})
+	h.HandleFunc("/readyz", h.readyzEndpoint)
 	logrus.Infof("Starting the h.ec2Provider.startEc2DescribeBatchProcessing ")
 	go h.ec2Provider.StartEc2DescribeBatchProcessing()
 	return h
@@ -197,8 +233,18 @@ func createMetrics() metrics {
 			Name:      "authenticate_latency_seconds",
 			Help:      "The latency for authenticate call",
 		}, []string{"result"}),
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricNS,
+			Name:      "verify_total",
+			Help:      "The number of token verifications by result",
+		}, []string{"result"}),
+		stsLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricNS,
+			Name:      "sts_request_latency_seconds",
+			Help:      "The latency of calls to STS while verifying tokens",
+		}),
 	}
-	prometheus.MustRegister(m.latency)
+	prometheus.MustRegister(m.latency, m.verifications, m.stsLatency)
 	return m
 }
 
@@ -240,6 +286,19 @@ func duration(start time.Time) float64 {
 	return time.Since(start).Seconds()
 }
 
+// readyzEndpoint reports the server as ready only while STS can be reached,
+// since no token can be verified otherwise.
+func (h *handler) readyzEndpoint(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), readyzTimeout)
+	defer cancel()
+	if err := h.verifier.Ping(ctx); err != nil {
+		logrus.WithError(err).Warn("readiness check failed")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "ok")
+}
+
 func (h *handler) isLoggableIdentity(identity *token.Identity) bool {
 	for _, account := range h.scrubbedAccounts {
 		if identity.AccountID == account {
@@ -286,6 +345,14 @@ func (h *handler) authenticateEndpoint(w http.ResponseWriter, req *http.Request)
 
 	// if the token is invalid, reject with a 403
 	identity, err := h.verifier.Verify(tokenReview.Spec.Token)
+	if _, ok := err.(token.OverloadedError); ok {
+		// the token wasn't checked, so ask the API server to retry later
+		// rather than deny it
+		h.metrics.latency.WithLabelValues(metricSTSError).Observe(duration(start))
+		log.WithError(err).Warn("too many concurrent token reviews")
+		http.Error(w, "too many concurrent token reviews", http.StatusTooManyRequests)
+		return
+	}
 	if err != nil {
 		if _, ok := err.(token.STSError); ok {
 			h.metrics.latency.WithLabelValues(metricSTSError).Observe(duration(start))
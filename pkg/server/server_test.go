@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -117,6 +118,8 @@ func createIndexer() cache.Indexer {
 
 func cleanup(m metrics) {
 	prometheus.Unregister(m.latency)
+	prometheus.Unregister(m.verifications)
+	prometheus.Unregister(m.stsLatency)
 }
 
 // Count of expected metrics
@@ -284,6 +287,7 @@ func testIsLoggableIdentity(t *testing.T) {
 type testVerifier struct {
 	identity *token.Identity
 	err      error
+	pingErr  error
 	param    string
 }
 
@@ -292,6 +296,41 @@ func (v *testVerifier) Verify(token string) (*token.Identity, error) {
 	return v.identity, v.err
 }
 
+func (v *testVerifier) VerifyLocal(token string) (*token.PresignedRequestInfo, error) {
+	v.param = token
+	return nil, v.err
+}
+
+func (v *testVerifier) Ping(ctx context.Context) error {
+	return v.pingErr
+}
+
+func (v *testVerifier) SetClusterID(clusterID string) {}
+
+func TestReadyz(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://k8s.io/readyz", nil)
+	h := setup(&testVerifier{})
+	defer cleanup(h.metrics)
+	h.readyzEndpoint(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, was %d", http.StatusOK, resp.Code)
+	}
+	verifyBodyContains(t, resp, "ok")
+}
+
+func TestReadyzSTSUnreachable(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://k8s.io/readyz", nil)
+	h := setup(&testVerifier{pingErr: token.NewSTSError("STS is unreachable: connection refused")})
+	defer cleanup(h.metrics)
+	h.readyzEndpoint(resp, req)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, was %d", http.StatusServiceUnavailable, resp.Code)
+	}
+	verifyBodyContains(t, resp, "STS is unreachable")
+}
+
 func TestAuthenticateVerifierError(t *testing.T) {
 	resp := httptest.NewRecorder()
 
@@ -358,6 +397,27 @@ func TestAuthenticateVerifierSTSError(t *testing.T) {
 	validateMetrics(t, validateOpts{stsError: 1})
 }
 
+func TestAuthenticateVerifierOverloaded(t *testing.T) {
+	resp := httptest.NewRecorder()
+
+	data, err := json.Marshal(authenticationv1beta1.TokenReview{
+		Spec: authenticationv1beta1.TokenReviewSpec{
+			Token: "token",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal in put data: %v", err)
+	}
+	req := httptest.NewRequest("POST", "http://k8s.io/authenticate", bytes.NewReader(data))
+	h := setup(&testVerifier{err: token.OverloadedError{}})
+	defer cleanup(h.metrics)
+	h.authenticateEndpoint(resp, req)
+	if resp.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, was %d", http.StatusTooManyRequests, resp.Code)
+	}
+	validateMetrics(t, validateOpts{stsError: 1})
+}
+
 func TestAuthenticateVerifierSTSErrorCRD(t *testing.T) {
 	resp := httptest.NewRecorder()
 
@@ -0,0 +1,132 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"errors"
+)
+
+// Constant-time implementations of unpadded base64url (base64.RawURLEncoding)
+// encoding and decoding. encoding/base64 uses table lookups indexed by the
+// input and returns as soon as it finds an invalid character, so its timing
+// depends on the contents of the token. These functions only branch on the
+// length of the input, which is public anyway. Unlike encoding/base64, line
+// breaks in the input are not skipped, tokens never contain them.
+
+var errIllegalBase64 = errors.New("illegal base64 data")
+
+// decodeBase64Char maps a base64url character to its 6 bit value, or to -1
+// if it isn't part of the alphabet. Each range check computes a mask that is
+// all ones when lo < c < hi, without branching on c.
+func decodeBase64Char(c int32) int32 {
+	ret := int32(-1)
+	// 'A'-'Z' is 0-25
+	ret += (((0x40 - c) & (c - 0x5b)) >> 8) & (c - 0x41 + 1)
+	// 'a'-'z' is 26-51
+	ret += (((0x60 - c) & (c - 0x7b)) >> 8) & (c - 0x61 + 26 + 1)
+	// '0'-'9' is 52-61
+	ret += (((0x2f - c) & (c - 0x3a)) >> 8) & (c - 0x30 + 52 + 1)
+	// '-' is 62
+	ret += (((0x2c - c) & (c - 0x2e)) >> 8) & (62 + 1)
+	// '_' is 63
+	ret += (((0x5e - c) & (c - 0x60)) >> 8) & (63 + 1)
+	return ret
+}
+
+// encodeBase64Char maps a 6 bit value to its base64url character by adding
+// the offset of the range it falls in, again without branching on the value.
+func encodeBase64Char(src int32) byte {
+	diff := int32(0x41)
+	// 26-51 are 'a'-'z'
+	diff += ((25 - src) >> 8) & (0x61 - 0x41 - 26)
+	// 52-61 are '0'-'9'
+	diff -= ((51 - src) >> 8) & (0x61 + 26 - 0x30)
+	// 62 is '-'
+	diff -= ((61 - src) >> 8) & (0x30 + 10 - 0x2d)
+	// 63 is '_'
+	diff += ((62 - src) >> 8) & (0x5f - 0x2d - 1)
+	return byte(src + diff)
+}
+
+// encodeBase64 returns the unpadded base64url encoding of src.
+func encodeBase64(src []byte) string {
+	dst := make([]byte, (len(src)*8+5)/6)
+	di, si := 0, 0
+	for ; si+3 <= len(src); si += 3 {
+		b0, b1, b2 := int32(src[si]), int32(src[si+1]), int32(src[si+2])
+		dst[di] = encodeBase64Char(b0 >> 2)
+		dst[di+1] = encodeBase64Char((b0<<4 | b1>>4) & 0x3f)
+		dst[di+2] = encodeBase64Char((b1<<2 | b2>>6) & 0x3f)
+		dst[di+3] = encodeBase64Char(b2 & 0x3f)
+		di += 4
+	}
+	switch len(src) - si {
+	case 1:
+		b0 := int32(src[si])
+		dst[di] = encodeBase64Char(b0 >> 2)
+		dst[di+1] = encodeBase64Char((b0 << 4) & 0x3f)
+	case 2:
+		b0, b1 := int32(src[si]), int32(src[si+1])
+		dst[di] = encodeBase64Char(b0 >> 2)
+		dst[di+1] = encodeBase64Char((b0<<4 | b1>>4) & 0x3f)
+		dst[di+2] = encodeBase64Char((b1 << 2) & 0x3f)
+	}
+	return string(dst)
+}
+
+// decodeBase64 returns the bytes represented by the unpadded base64url string
+// s. Invalid characters are accumulated and reported once the whole input has
+// been decoded, so the time taken doesn't reveal where they are.
+func decodeBase64(s string) ([]byte, error) {
+	if len(s)%4 == 1 {
+		return nil, errIllegalBase64
+	}
+
+	dst := make([]byte, len(s)*6/8)
+	var invalid int32
+	di, si := 0, 0
+	for ; si+4 <= len(s); si += 4 {
+		c0 := decodeBase64Char(int32(s[si]))
+		c1 := decodeBase64Char(int32(s[si+1]))
+		c2 := decodeBase64Char(int32(s[si+2]))
+		c3 := decodeBase64Char(int32(s[si+3]))
+		invalid |= c0 | c1 | c2 | c3
+		dst[di] = byte(c0<<2 | c1>>4)
+		dst[di+1] = byte(c1<<4 | c2>>2)
+		dst[di+2] = byte(c2<<6 | c3)
+		di += 3
+	}
+	switch len(s) - si {
+	case 2:
+		c0 := decodeBase64Char(int32(s[si]))
+		c1 := decodeBase64Char(int32(s[si+1]))
+		invalid |= c0 | c1
+		dst[di] = byte(c0<<2 | c1>>4)
+	case 3:
+		c0 := decodeBase64Char(int32(s[si]))
+		c1 := decodeBase64Char(int32(s[si+1]))
+		c2 := decodeBase64Char(int32(s[si+2]))
+		invalid |= c0 | c1 | c2
+		dst[di] = byte(c0<<2 | c1>>4)
+		dst[di+1] = byte(c1<<4 | c2>>2)
+	}
+
+	if invalid < 0 {
+		return nil, errIllegalBase64
+	}
+	return dst, nil
+}
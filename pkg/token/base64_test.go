@@ -0,0 +1,87 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/rand"
+	"testing"
+)
+
+func TestBase64MatchesStdlib(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 256; n++ {
+		src := make([]byte, n)
+		r.Read(src)
+
+		encoded := encodeBase64(src)
+		expected := base64.RawURLEncoding.EncodeToString(src)
+		if encoded != expected {
+			t.Fatalf("encoding %v: expected %q but was %q", src, expected, encoded)
+		}
+
+		decoded, err := decodeBase64(encoded)
+		if err != nil {
+			t.Fatalf("decoding %q: unexpected error %v", encoded, err)
+		}
+		if !bytes.Equal(decoded, src) {
+			t.Fatalf("decoding %q: expected %v but was %v", encoded, src, decoded)
+		}
+	}
+}
+
+func TestBase64DecodeAlphabet(t *testing.T) {
+	for c := 0; c < 256; c++ {
+		_, stdErr := base64.RawURLEncoding.DecodeString(string([]byte{byte(c), 'A'}))
+		_, err := decodeBase64(string([]byte{byte(c), 'A'}))
+		if c == '\r' || c == '\n' {
+			// encoding/base64 skips line breaks, we don't
+			if err == nil {
+				t.Errorf("expected %q to be rejected", c)
+			}
+			continue
+		}
+		if (stdErr == nil) != (err == nil) {
+			t.Errorf("character %q: stdlib error %v, got %v", c, stdErr, err)
+		}
+	}
+}
+
+func TestBase64DecodeErrors(t *testing.T) {
+	for _, s := range []string{"A", "AAAAA", "AA=A", "AAA+", "AAA/", "AA A", "ABC\x00"} {
+		if _, err := decodeBase64(s); err != errIllegalBase64 {
+			t.Errorf("expected %q to be rejected, got %v", s, err)
+		}
+	}
+}
+
+func BenchmarkDecodeBase64(b *testing.B) {
+	token := validToken[len(v1Prefix):]
+	b.SetBytes(int64(len(token)))
+	for i := 0; i < b.N; i++ {
+		decodeBase64(token)
+	}
+}
+
+func BenchmarkDecodeBase64Stdlib(b *testing.B) {
+	token := validToken[len(v1Prefix):]
+	b.SetBytes(int64(len(token)))
+	for i := 0; i < b.N; i++ {
+		base64.RawURLEncoding.DecodeString(token)
+	}
+}
+
+func BenchmarkEncodeBase64(b *testing.B) {
+	url := []byte(validURL)
+	b.SetBytes(int64(len(url)))
+	for i := 0; i < b.N; i++ {
+		encodeBase64(url)
+	}
+}
+
+func BenchmarkEncodeBase64Stdlib(b *testing.B) {
+	url := []byte(validURL)
+	b.SetBytes(int64(len(url)))
+	for i := 0; i < b.N; i++ {
+		base64.RawURLEncoding.EncodeToString(url)
+	}
+}
@@ -1,13 +1,18 @@
 package token
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,6 +23,17 @@ import (
 // env variable name for custom credential cache file location
 const cacheFileNameEnv = "AWS_IAM_AUTHENTICATOR_CACHE_FILE"
 
+const (
+	// delay between attempts to lock the cache file
+	lockRetryDelay = 250 * time.Millisecond
+	// default upper bound of the random jitter added to lockRetryDelay
+	defaultLockRetryJitter = 100 * time.Millisecond
+	// default time to wait for the cache file to lock
+	defaultLockTimeout = time.Second
+	// default delay before retrying the underlying provider
+	defaultRetrieveBackoff = 200 * time.Millisecond
+)
+
 // A mockable filesystem interface
 var f filesystem = osFS{}
 
@@ -26,6 +42,8 @@ type filesystem interface {
 	ReadFile(filename string) ([]byte, error)
 	WriteFile(filename string, data []byte, perm os.FileMode) error
 	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
 }
 
 // default os based implementation
@@ -47,6 +65,14 @@ func (osFS) MkdirAll(path string, perm os.FileMode) error {
 	return os.MkdirAll(path, perm)
 }
 
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
 // A mockable environment interface
 var e environment = osEnv{}
 
@@ -69,6 +95,8 @@ func (osEnv) LookupEnv(key string) (string, bool) {
 // A mockable flock interface
 type filelock interface {
 	Unlock() error
+	TryLock() (bool, error)
+	TryRLock() (bool, error)
 	TryLockContext(ctx context.Context, retryDelay time.Duration) (bool, error)
 	TryRLockContext(ctx context.Context, retryDelay time.Duration) (bool, error)
 }
@@ -77,10 +105,152 @@ var newFlock = func(filename string) filelock {
 	return flock.New(filename)
 }
 
+// A mockable source of jitter, seeded per process so that concurrent
+// processes don't pick the same delays.
+var jitter = func() func(n int64) int64 {
+	var lock sync.Mutex
+	r := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+	return func(n int64) int64 {
+		lock.Lock()
+		defer lock.Unlock()
+		return r.Int63n(n)
+	}
+}()
+
+// CacheFormat is the serialization format of the cache file.
+type CacheFormat string
+
+const (
+	// CacheFormatYAML is the default format of the cache file.
+	CacheFormatYAML CacheFormat = "yaml"
+	// CacheFormatJSON is the format of cache files named *.json.
+	CacheFormatJSON CacheFormat = "json"
+)
+
+// marshal serializes v in the format.
+func (c CacheFormat) marshal(v interface{}) ([]byte, error) {
+	if c == CacheFormatJSON {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return yaml.Marshal(v)
+}
+
+// unmarshal parses data in the format into v. Like an empty YAML document,
+// empty JSON leaves v unchanged.
+func (c CacheFormat) unmarshal(data []byte, v interface{}) error {
+	if c == CacheFormatJSON {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		return json.Unmarshal(data, v)
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+// FileCacheOptions configures how a FileCacheProvider locks and serializes
+// the cache file.
+type FileCacheOptions struct {
+	// LockRetryJitter is the upper bound of a random delay added between
+	// attempts to lock the cache file, so that many processes contending for
+	// the lock don't retry in lockstep. Zero disables jitter.
+	LockRetryJitter time.Duration
+	// LockTimeout is how long to wait for the cache file to lock. Zero uses
+	// the default of one second.
+	LockTimeout time.Duration
+	// Format is the serialization format of the cache file. If empty, it is
+	// CacheFormatJSON for files named *.json and CacheFormatYAML otherwise.
+	Format CacheFormat
+	// RetrieveAttempts is how many times credentials are fetched from the
+	// underlying provider before giving up on a cache miss. Zero means a
+	// single attempt.
+	RetrieveAttempts int
+	// RetrieveBackoff is the delay before the first retry of the underlying
+	// provider, doubled before each further retry. Zero uses the default of
+	// 200 milliseconds.
+	RetrieveBackoff time.Duration
+	// Metrics counts cache hits and misses in Retrieve, and how often the
+	// cache file is already locked by another process.
+	Metrics CacheMetricsRecorder
+}
+
+// DefaultFileCacheOptions returns the options used by NewFileCacheProvider.
+func DefaultFileCacheOptions() FileCacheOptions {
+	return FileCacheOptions{
+		LockRetryJitter: defaultLockRetryJitter,
+		LockTimeout:     defaultLockTimeout,
+	}
+}
+
+// lockRetryDelay returns the delay between attempts to lock the cache file,
+// including a random jitter.
+func (o FileCacheOptions) lockRetryDelay() time.Duration {
+	if o.LockRetryJitter <= 0 {
+		return lockRetryDelay
+	}
+	return lockRetryDelay + time.Duration(jitter(int64(o.LockRetryJitter)+1))
+}
+
+// lockTimeout returns how long to wait for the cache file to lock.
+func (o FileCacheOptions) lockTimeout() time.Duration {
+	if o.LockTimeout <= 0 {
+		return defaultLockTimeout
+	}
+	return o.LockTimeout
+}
+
+// format returns the serialization format of the cache file filename.
+func (o FileCacheOptions) format(filename string) (CacheFormat, error) {
+	switch o.Format {
+	case CacheFormatYAML, CacheFormatJSON:
+		return o.Format, nil
+	case "":
+		if strings.EqualFold(filepath.Ext(filename), ".json") {
+			return CacheFormatJSON, nil
+		}
+		return CacheFormatYAML, nil
+	default:
+		return "", fmt.Errorf("unknown cache file format %q", o.Format)
+	}
+}
+
+// metrics returns the CacheMetricsRecorder, which does nothing unless one was
+// set in the options.
+func (o FileCacheOptions) metrics() CacheMetricsRecorder {
+	if o.Metrics == nil {
+		return noopCacheMetricsRecorder{}
+	}
+	return o.Metrics
+}
+
+// lock takes a shared or exclusive lock on the cache file, waiting for it as
+// configured. Having to wait is reported as lock contention.
+func (o FileCacheOptions) lock(ctx context.Context, lock filelock, exclusive bool) (bool, error) {
+	tryLock, tryLockContext := lock.TryRLock, lock.TryRLockContext
+	if exclusive {
+		tryLock, tryLockContext = lock.TryLock, lock.TryLockContext
+	}
+	if ok, err := tryLock(); ok || err != nil {
+		return ok, err
+	}
+	o.metrics().ObserveLockContention()
+	ctx, cancel := context.WithTimeout(ctx, o.lockTimeout())
+	defer cancel()
+	return tryLockContext(ctx, o.lockRetryDelay())
+}
+
+// retrieveBackoff returns the delay before the first retry of the underlying
+// provider.
+func (o FileCacheOptions) retrieveBackoff() time.Duration {
+	if o.RetrieveBackoff <= 0 {
+		return defaultRetrieveBackoff
+	}
+	return o.RetrieveBackoff
+}
+
 // cacheFile is a map of clusterID/roleARNs to cached credentials
 type cacheFile struct {
 	// a map of clusterIDs/profiles/roleARNs to cachedCredentials
-	ClusterMap map[string]map[string]map[string]cachedCredential `yaml:"clusters"`
+	ClusterMap map[string]map[string]map[string]cachedCredential `yaml:"clusters" json:"clusters"`
 }
 
 // a utility type for dealing with compound cache keys
@@ -115,7 +285,7 @@ func (c *cacheFile) Get(key cacheKey) (credential cachedCredential) {
 
 // cachedCredential is a single cached credential entry
 type cachedCredential struct {
-	Credential *aws.Credentials
+	Credential *aws.Credentials `json:"credential"`
 }
 
 // UnmarshalYAML supports reading up from old credential format
@@ -161,9 +331,9 @@ func (c *cachedCredential) IsExpired() bool {
 }
 
 // readCacheWhileLocked reads the contents of the credential cache and returns the
-// parsed yaml as a cacheFile object.  This method must be called while a shared
-// lock is held on the filename.
-func readCacheWhileLocked(filename string) (cache cacheFile, err error) {
+// parsed yaml or json as a cacheFile object.  This method must be called while a
+// shared lock is held on the filename.
+func readCacheWhileLocked(filename string, format CacheFormat) (cache cacheFile, err error) {
 	cache = cacheFile{
 		map[string]map[string]map[string]cachedCredential{},
 	}
@@ -173,7 +343,7 @@ func readCacheWhileLocked(filename string) (cache cacheFile, err error) {
 		return
 	}
 
-	err = yaml.Unmarshal(data, &cache)
+	err = format.unmarshal(data, &cache)
 	if err != nil {
 		err = fmt.Errorf("unable to parse file %s: %v", filename, err)
 	}
@@ -181,10 +351,10 @@ func readCacheWhileLocked(filename string) (cache cacheFile, err error) {
 }
 
 // writeCacheWhileLocked writes the contents of the credential cache using the
-// yaml marshaled form of the passed cacheFile object.  This method must be
-// called while an exclusive lock is held on the filename.
-func writeCacheWhileLocked(filename string, cache cacheFile) error {
-	data, err := yaml.Marshal(cache)
+// yaml or json marshaled form of the passed cacheFile object.  This method must
+// be called while an exclusive lock is held on the filename.
+func writeCacheWhileLocked(filename string, cache cacheFile, format CacheFormat) error {
+	data, err := format.marshal(cache)
 	if err == nil {
 		// write privately owned by the user
 		err = f.WriteFile(filename, data, 0o600)
@@ -199,6 +369,8 @@ type FileCacheProvider struct {
 	credentials      aws.CredentialsProvider // the underlying implementation that has the *real* Provider
 	cacheKey         cacheKey                // cache key parameters used to create Provider
 	cachedCredential cachedCredential        // the cached credential, if it exists
+	options          FileCacheOptions        // options for locking the cache file
+	filename         string                  // path of the cache file
 }
 
 // NewFileCacheProvider creates a new Provider implementation that wraps a provided Credentials,
@@ -206,10 +378,29 @@ type FileCacheProvider struct {
 // If there are any problems accessing or initializing the cache, an error will be returned, and
 // callers should just use the existing credentials provider.
 func NewFileCacheProvider(clusterID, profile, roleARN string, creds aws.CredentialsProvider) (FileCacheProvider, error) {
+	return NewFileCacheProviderWithOptions(clusterID, profile, roleARN, creds, DefaultFileCacheOptions())
+}
+
+// NewFileCacheProviderWithOptions behaves like NewFileCacheProvider, locking the cache file
+// as configured by options.
+func NewFileCacheProviderWithOptions(clusterID, profile, roleARN string, creds aws.CredentialsProvider, options FileCacheOptions) (FileCacheProvider, error) {
+	return newFileCacheProvider(CacheFilename(), clusterID, profile, roleARN, creds, options)
+}
+
+// NewFileCacheProviderWithPath behaves like NewFileCacheProvider, but caches credentials
+// in the file at path instead of consulting the environment for its location.
+func NewFileCacheProviderWithPath(path, clusterID, profile, roleARN string, creds aws.CredentialsProvider) (FileCacheProvider, error) {
+	return newFileCacheProvider(path, clusterID, profile, roleARN, creds, DefaultFileCacheOptions())
+}
+
+func newFileCacheProvider(filename, clusterID, profile, roleARN string, creds aws.CredentialsProvider, options FileCacheOptions) (FileCacheProvider, error) {
 	if creds == nil {
 		return FileCacheProvider{}, errors.New("no underlying Credentials object provided")
 	}
-	filename := CacheFilename()
+	format, err := options.format(filename)
+	if err != nil {
+		return FileCacheProvider{}, err
+	}
 	cacheKey := cacheKey{clusterID, profile, roleARN}
 	cachedCredential := cachedCredential{}
 	// ensure path to cache file exists
@@ -223,16 +414,14 @@ func NewFileCacheProvider(clusterID, profile, roleARN string, creds aws.Credenti
 		// do file locking on cache to prevent inconsistent reads
 		lock := newFlock(filename)
 		defer lock.Unlock()
-		// wait up to a second for the file to lock
-		ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
-		defer cancel()
-		ok, err := lock.TryRLockContext(ctx, 250*time.Millisecond) // try to lock every 1/4 second
+		// wait for the file to lock
+		ok, err := options.lock(context.TODO(), lock, false)
 		if !ok {
 			// unable to lock the cache, something is wrong, refuse to use it.
 			return FileCacheProvider{}, fmt.Errorf("unable to read lock file %s: %v", filename, err)
 		}
 
-		cache, err := readCacheWhileLocked(filename)
+		cache, err := readCacheWhileLocked(filename, format)
 		if err != nil {
 			// can't read or parse cache, refuse to use it.
 			return FileCacheProvider{}, err
@@ -248,6 +437,8 @@ func NewFileCacheProvider(clusterID, profile, roleARN string, creds aws.Credenti
 		creds,
 		cacheKey,
 		cachedCredential,
+		options,
+		filename,
 	}, nil
 }
 
@@ -257,45 +448,87 @@ func NewFileCacheProvider(clusterID, profile, roleARN string, creds aws.Credenti
 func (f *FileCacheProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
 	if !f.cachedCredential.IsExpired() {
 		// use the cached credential
+		f.options.metrics().ObserveCacheHit()
 		return *f.cachedCredential.Credential, nil
 	} else {
+		f.options.metrics().ObserveCacheMiss()
 		_, _ = fmt.Fprintf(os.Stderr, "No cached credential available.  Refreshing...\n")
 		// fetch the credentials from the underlying Provider
-		credential, err := f.credentials.Retrieve(ctx)
+		credential, err := f.retrieveWithBackoff(ctx)
 		if err != nil {
 			return credential, err
 		}
 		// underlying provider supports Expirer interface, so we can cache
-		filename := CacheFilename()
-		// do file locking on cache to prevent inconsistent writes
-		lock := newFlock(filename)
-		defer lock.Unlock()
-		// wait up to a second for the file to lock
-		ctx, cancel := context.WithTimeout(ctx, time.Second)
-		defer cancel()
-		ok, err := lock.TryLockContext(ctx, 250*time.Millisecond) // try to lock every 1/4 second
-		if !ok {
-			// can't get write lock to create/update cache, but still return the credential
-			_, _ = fmt.Fprintf(os.Stderr, "Unable to write lock file %s: %v\n", filename, err)
-			return credential, nil
-		}
 		f.cachedCredential = cachedCredential{
 			&credential,
 		}
-		// don't really care about read error.  Either read the cache, or we create a new cache.
-		cache, _ := readCacheWhileLocked(filename)
-		cache.Put(f.cacheKey, f.cachedCredential)
-		err = writeCacheWhileLocked(filename, cache)
-		if err != nil {
+		if err := putCredential(ctx, f.filename, f.cacheKey, credential, f.options); err != nil {
 			// can't write cache, but still return the credential
-			_, _ = fmt.Fprintf(os.Stderr, "Unable to update credential cache %s: %v\n", filename, err)
-			err = nil
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to cache credential: %v\n", err)
 		} else {
 			_, _ = fmt.Fprintf(os.Stderr, "Updated cached credential\n")
 		}
 
-		return credential, err
+		return credential, nil
+	}
+}
+
+// retrieveWithBackoff fetches credentials from the underlying provider, retrying
+// failures with exponential backoff up to options.RetrieveAttempts times in
+// total, as long as ctx isn't done.
+func (f *FileCacheProvider) retrieveWithBackoff(ctx context.Context) (aws.Credentials, error) {
+	backoff := f.options.retrieveBackoff()
+	for attempt := 1; ; attempt++ {
+		credential, err := f.credentials.Retrieve(ctx)
+		if err == nil || attempt >= f.options.RetrieveAttempts {
+			return credential, err
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to retrieve credential, retrying in %s: %v\n", backoff, err)
+		select {
+		case <-ctx.Done():
+			return credential, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// PutCredential writes cred to the credential cache for clusterID, profile, and
+// roleARN, so that tools getting credentials by other means can warm the cache
+// for later FileCacheProviders.
+func PutCredential(clusterID, profile, roleARN string, cred aws.Credentials) error {
+	filename := CacheFilename()
+	// ensure path to cache file exists
+	_ = f.MkdirAll(filepath.Dir(filename), 0o700)
+	if info, err := f.Stat(filename); err == nil && info.Mode()&0o077 != 0 {
+		// cache file has secret credentials and should only be accessible to the user, refuse to use it.
+		return fmt.Errorf("cache file %s is not private", filename)
+	}
+	return putCredential(context.Background(), filename, cacheKey{clusterID, profile, roleARN}, cred, DefaultFileCacheOptions())
+}
+
+// putCredential writes credential to the cache file under key, while holding
+// an exclusive lock on it.
+func putCredential(ctx context.Context, filename string, key cacheKey, credential aws.Credentials, options FileCacheOptions) error {
+	format, err := options.format(filename)
+	if err != nil {
+		return err
+	}
+	// do file locking on cache to prevent inconsistent writes
+	lock := newFlock(filename)
+	defer lock.Unlock()
+	// wait for the file to lock
+	ok, err := options.lock(ctx, lock, true)
+	if !ok {
+		return fmt.Errorf("unable to write lock file %s: %v", filename, err)
+	}
+	// don't really care about read error.  Either read the cache, or we create a new cache.
+	cache, _ := readCacheWhileLocked(filename, format)
+	cache.Put(key, cachedCredential{&credential})
+	if err := writeCacheWhileLocked(filename, cache, format); err != nil {
+		return fmt.Errorf("unable to update credential cache %s: %v", filename, err)
 	}
+	return nil
 }
 
 // Invalidate will invalidate the cached credentials. The next call to Retrieve
@@ -3,12 +3,15 @@ package token
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"gopkg.in/yaml.v2"
 )
 
 type stubProvider struct {
@@ -36,6 +39,21 @@ func (s *stubProviderExpirer) ExpiresAt() time.Time {
 	return s.expiration
 }
 
+// flakyProvider fails the first failures calls to Retrieve.
+type flakyProvider struct {
+	stubProvider
+	failures int
+	calls    int
+}
+
+func (s *flakyProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return aws.Credentials{}, errors.New("sts blip")
+	}
+	return s.stubProvider.Retrieve(ctx)
+}
+
 type testFileInfo struct {
 	name    string
 	size    int64
@@ -81,6 +99,16 @@ func (t *testFS) MkdirAll(path string, perm os.FileMode) error {
 	return t.err
 }
 
+func (t *testFS) Rename(oldpath, newpath string) error {
+	t.filename = newpath
+	return t.err
+}
+
+func (t *testFS) Remove(name string) error {
+	t.filename = name
+	return t.err
+}
+
 func (t *testFS) reset() {
 	t.filename = ""
 	t.fileinfo = testFileInfo{}
@@ -111,12 +139,22 @@ type testFilelock struct {
 	retryDelay time.Duration
 	success    bool
 	err        error
+	// uncontended makes the first, non-blocking attempt to lock succeed
+	uncontended bool
 }
 
 func (l *testFilelock) Unlock() error {
 	return nil
 }
 
+func (l *testFilelock) TryLock() (bool, error) {
+	return l.uncontended, nil
+}
+
+func (l *testFilelock) TryRLock() (bool, error) {
+	return l.uncontended, nil
+}
+
 func (l *testFilelock) TryLockContext(ctx context.Context, retryDelay time.Duration) (bool, error) {
 	l.ctx = ctx
 	l.retryDelay = retryDelay
@@ -134,6 +172,7 @@ func (l *testFilelock) reset() {
 	l.retryDelay = 0
 	l.success = true
 	l.err = nil
+	l.uncontended = false
 }
 
 func getMocks() (tf *testFS, te *testEnv, testFlock *testFilelock) {
@@ -234,6 +273,24 @@ func TestNewFileCacheProvider_BadPermissions(t *testing.T) {
 	}
 }
 
+func TestNewFileCacheProviderWithPath_BadPermissions(t *testing.T) {
+	c := aws.NewCredentialsCache(&stubProvider{})
+
+	tf, te, _ := getMocks()
+	te.values["AWS_IAM_AUTHENTICATOR_CACHE_FILE"] = "special.yaml"
+
+	// bad permissions
+	tf.fileinfo.mode = 0o777
+	_, err := NewFileCacheProviderWithPath("explicit.yaml", "CLUSTER", "PROFILE", "ARN", c)
+	if err == nil {
+		t.Errorf("Expected error due to public permissions")
+	}
+	if tf.filename != "explicit.yaml" {
+		t.Errorf("unexpected file checked, expected %s, got %s",
+			"explicit.yaml", tf.filename)
+	}
+}
+
 func TestNewFileCacheProvider_Unlockable(t *testing.T) {
 	c := aws.NewCredentialsCache(&stubProvider{})
 
@@ -290,6 +347,35 @@ func TestNewFileCacheProvider_Empty(t *testing.T) {
 	}
 }
 
+func TestNewFileCacheProvider_LockRetryJitter(t *testing.T) {
+	c := aws.NewCredentialsCache(&stubProvider{})
+
+	_, _, testFlock := getMocks()
+
+	maxJitter := 100 * time.Millisecond
+	for i := 0; i < 20; i++ {
+		p, err := NewFileCacheProviderWithOptions("CLUSTER", "PROFILE", "ARN", c, FileCacheOptions{
+			LockRetryJitter: maxJitter,
+			LockTimeout:     2 * time.Second,
+		})
+		validateFileCacheProvider(t, p, err, c)
+		if testFlock.retryDelay < lockRetryDelay || testFlock.retryDelay > lockRetryDelay+maxJitter {
+			t.Errorf("retry delay %v not within [%v, %v]", testFlock.retryDelay, lockRetryDelay, lockRetryDelay+maxJitter)
+		}
+		deadline, ok := testFlock.ctx.Deadline()
+		if !ok || time.Until(deadline) > 2*time.Second {
+			t.Errorf("lock context should have a deadline within the lock timeout, got %v", deadline)
+		}
+	}
+
+	// no jitter
+	p, err := NewFileCacheProviderWithOptions("CLUSTER", "PROFILE", "ARN", c, FileCacheOptions{})
+	validateFileCacheProvider(t, p, err, c)
+	if testFlock.retryDelay != lockRetryDelay {
+		t.Errorf("retry delay without jitter should be %v, got %v", lockRetryDelay, testFlock.retryDelay)
+	}
+}
+
 func TestNewFileCacheProvider_ExistingCluster(t *testing.T) {
 	c := aws.NewCredentialsCache(&stubProvider{})
 
@@ -542,3 +628,295 @@ func TestFileCacheProvider_Retrieve_CacheHit(t *testing.T) {
 		t.Errorf("cached credential not returned")
 	}
 }
+
+func TestFileCacheProviderWithPath_Retrieve(t *testing.T) {
+	_, _, c := makeExpirerCredentials()
+
+	tf, te, _ := getMocks()
+	te.values["AWS_IAM_AUTHENTICATOR_CACHE_FILE"] = "special.yaml"
+	var locked []string
+	lockFile := newFlock
+	newFlock = func(filename string) filelock {
+		locked = append(locked, filename)
+		return lockFile(filename)
+	}
+
+	// initialize from existing cache file
+	tf.fileinfo.mode = 0o600
+	tf.data = []byte("")
+	p, err := NewFileCacheProviderWithPath("explicit.yaml", "CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if tf.filename != "explicit.yaml" {
+		t.Errorf("Wrote to wrong file, expected %v, got %v",
+			"explicit.yaml", tf.filename)
+	}
+	if len(locked) != 2 || locked[0] != "explicit.yaml" || locked[1] != "explicit.yaml" {
+		t.Errorf("Locked wrong files, expected explicit.yaml twice, got %v", locked)
+	}
+}
+
+func TestPutCredential(t *testing.T) {
+	tf, _, _ := getMocks()
+	tf.fileinfo.mode = 0o600
+
+	expiration := time.Now().In(time.UTC).Add(1 * time.Hour).Round(time.Nanosecond)
+	cred := aws.Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Source:          "warmer",
+		CanExpire:       true,
+		Expires:         expiration,
+	}
+	if err := PutCredential("CLUSTER", "PROFILE", "ARN", cred); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tf.filename != CacheFilename() {
+		t.Errorf("Wrote to wrong file, expected %v, got %v", CacheFilename(), tf.filename)
+	}
+	if tf.perm != 0o600 {
+		t.Errorf("Wrote with wrong permissions, expected %o, got %o", 0o600, tf.perm)
+	}
+
+	// the written entry is read back by a provider, without calling its
+	// underlying provider
+	c := aws.NewCredentialsCache(&stubProvider{})
+	p, err := NewFileCacheProvider("CLUSTER", "PROFILE", "ARN", c)
+	validateFileCacheProvider(t, p, err, c)
+	credential, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if credential != cred {
+		t.Errorf("Cache did not return put credential, got %v, expected %v", credential, cred)
+	}
+}
+
+func TestPutCredential_KeepsOtherEntries(t *testing.T) {
+	tf, _, _ := getMocks()
+	tf.fileinfo.mode = 0o600
+	tf.data = []byte(`clusters:
+  CLUSTER:
+    PROFILE:
+      OTHER:
+        credential:
+          accesskeyid: ABC
+`)
+
+	if err := PutCredential("CLUSTER", "PROFILE", "ARN", makeCredential()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cache := cacheFile{map[string]map[string]map[string]cachedCredential{}}
+	if err := yaml.Unmarshal(tf.data, &cache); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cred := cache.Get(cacheKey{"CLUSTER", "PROFILE", "OTHER"}); cred.Credential == nil || cred.Credential.AccessKeyID != "ABC" {
+		t.Errorf("existing entry was not kept, got %v", cred.Credential)
+	}
+	if cred := cache.Get(cacheKey{"CLUSTER", "PROFILE", "ARN"}); cred.Credential == nil || *cred.Credential != makeCredential() {
+		t.Errorf("put entry was not written, got %v", cred.Credential)
+	}
+}
+
+func TestPutCredential_BadPermissions(t *testing.T) {
+	tf, _, _ := getMocks()
+	tf.fileinfo.mode = 0o777
+
+	err := PutCredential("CLUSTER", "PROFILE", "ARN", makeCredential())
+	if err == nil || !strings.Contains(err.Error(), "is not private") {
+		t.Errorf("Expected error due to public permissions, got %v", err)
+	}
+}
+
+func TestPutCredential_Unlockable(t *testing.T) {
+	tf, _, testFlock := getMocks()
+	tf.fileinfo.mode = 0o600
+	testFlock.success = false
+	testFlock.err = errors.New("lock stuck, needs wd-40")
+
+	err := PutCredential("CLUSTER", "PROFILE", "ARN", makeCredential())
+	if err == nil || !strings.Contains(err.Error(), "unable to write lock file") {
+		t.Errorf("Expected error due to lock failure, got %v", err)
+	}
+}
+
+func TestFileCacheProvider_RoundTripFormats(t *testing.T) {
+	cases := []struct {
+		filename string
+		format   CacheFormat
+		expected CacheFormat
+	}{
+		{"credentials.yaml", "", CacheFormatYAML},
+		{"credentials", "", CacheFormatYAML},
+		{"credentials.json", "", CacheFormatJSON},
+		{"credentials.JSON", "", CacheFormatJSON},
+		{"credentials.cache", CacheFormatJSON, CacheFormatJSON},
+		{"credentials.json", CacheFormatYAML, CacheFormatYAML},
+	}
+	for _, c := range cases {
+		providerCredential := makeCredential()
+		providerCredential.Expires = time.Now().In(time.UTC).Add(1 * time.Hour).Round(time.Nanosecond)
+		creds := aws.NewCredentialsCache(&stubProviderExpirer{stubProvider{creds: providerCredential}, providerCredential.Expires})
+		options := DefaultFileCacheOptions()
+		options.Format = c.format
+
+		tf, _, _ := getMocks()
+		tf.fileinfo.mode = 0o600
+		p, err := newFileCacheProvider(c.filename, "CLUSTER", "PROFILE", "ARN", creds, options)
+		validateFileCacheProvider(t, p, err, creds)
+		if _, err := p.Retrieve(context.Background()); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.filename, err)
+		}
+
+		// the file is written in the expected format
+		cache := cacheFile{map[string]map[string]map[string]cachedCredential{}}
+		if c.expected == CacheFormatJSON {
+			err = json.Unmarshal(tf.data, &cache)
+		} else {
+			err = yaml.Unmarshal(tf.data, &cache)
+		}
+		if err != nil {
+			t.Errorf("%s: expected %s but got %s", c.filename, c.expected, tf.data)
+			continue
+		}
+
+		// and read back by a new provider, without calling the underlying provider
+		unused := aws.NewCredentialsCache(&stubProvider{})
+		p, err = newFileCacheProvider(c.filename, "CLUSTER", "PROFILE", "ARN", unused, options)
+		validateFileCacheProvider(t, p, err, unused)
+		credential, err := p.Retrieve(context.Background())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.filename, err)
+		}
+		if credential != providerCredential {
+			t.Errorf("%s: cache did not return written credential, got %v, expected %v",
+				c.filename, credential, providerCredential)
+		}
+	}
+}
+
+func TestNewFileCacheProvider_UnknownFormat(t *testing.T) {
+	c := aws.NewCredentialsCache(&stubProvider{})
+	getMocks()
+
+	options := DefaultFileCacheOptions()
+	options.Format = "toml"
+	_, err := NewFileCacheProviderWithOptions("CLUSTER", "PROFILE", "ARN", c, options)
+	if err == nil || !strings.Contains(err.Error(), `unknown cache file format "toml"`) {
+		t.Errorf("Expected error due to unknown format, got %v", err)
+	}
+}
+
+func TestFileCacheProvider_Retrieve_Backoff(t *testing.T) {
+	cases := []struct {
+		attempts      int
+		expectedCalls int
+		expectErr     bool
+	}{
+		{0, 1, true},
+		{2, 2, true},
+		{3, 3, false},
+		{5, 3, false},
+	}
+	for _, c := range cases {
+		tf, _, _ := getMocks()
+		tf.err = os.ErrNotExist
+		provider := &flakyProvider{stubProvider: stubProvider{creds: makeCredential()}, failures: 2}
+		options := DefaultFileCacheOptions()
+		options.RetrieveAttempts = c.attempts
+		options.RetrieveBackoff = time.Millisecond
+		p, err := NewFileCacheProviderWithOptions("CLUSTER", "PROFILE", "ARN", provider, options)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		_, err = p.Retrieve(context.Background())
+		if c.expectErr != (err != nil) {
+			t.Errorf("%d attempts: unexpected error %v", c.attempts, err)
+		}
+		if provider.calls != c.expectedCalls {
+			t.Errorf("%d attempts: expected %d calls to the provider, got %d", c.attempts, c.expectedCalls, provider.calls)
+		}
+	}
+}
+
+func TestFileCacheProvider_Retrieve_BackoffContextDone(t *testing.T) {
+	tf, _, _ := getMocks()
+	tf.err = os.ErrNotExist
+	provider := &flakyProvider{stubProvider: stubProvider{creds: makeCredential()}, failures: 2}
+	options := DefaultFileCacheOptions()
+	options.RetrieveAttempts = 3
+	options.RetrieveBackoff = time.Hour
+	p, err := NewFileCacheProviderWithOptions("CLUSTER", "PROFILE", "ARN", provider, options)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Retrieve(ctx); err == nil {
+		t.Error("Expected the provider error once the context is done")
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected 1 call to the provider, got %d", provider.calls)
+	}
+}
+
+type testCacheMetricsRecorder struct {
+	hits, misses, contentions int
+}
+
+func (m *testCacheMetricsRecorder) ObserveCacheHit()       { m.hits++ }
+func (m *testCacheMetricsRecorder) ObserveCacheMiss()      { m.misses++ }
+func (m *testCacheMetricsRecorder) ObserveLockContention() { m.contentions++ }
+
+func TestFileCacheProvider_Metrics(t *testing.T) {
+	tf, _, testFlock := getMocks()
+	testFlock.uncontended = true
+	expiration := time.Now().In(time.UTC).Add(1 * time.Hour).Round(time.Nanosecond)
+	tf.data = []byte(`clusters:
+  CLUSTER:
+    PROFILE:
+      ARN:
+        credential:
+          accesskeyid: ABC
+          secretaccesskey: DEF
+          canexpire: true
+          expires: ` + expiration.Format(time.RFC3339Nano) + `
+`)
+	metrics := &testCacheMetricsRecorder{}
+	options := DefaultFileCacheOptions()
+	options.Metrics = metrics
+	provider := &stubProvider{creds: makeCredential()}
+	p, err := NewFileCacheProviderWithOptions("CLUSTER", "PROFILE", "ARN", provider, options)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if metrics.hits != 1 || metrics.misses != 0 {
+		t.Errorf("Expected a single cache hit, got %d hits and %d misses", metrics.hits, metrics.misses)
+	}
+	if metrics.contentions != 0 {
+		t.Errorf("Expected no lock contention, got %d", metrics.contentions)
+	}
+
+	// the cache file is now locked by someone else while the credential is refreshed
+	testFlock.uncontended = false
+	p.Invalidate()
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if metrics.hits != 1 || metrics.misses != 1 {
+		t.Errorf("Expected a cache hit and miss, got %d hits and %d misses", metrics.hits, metrics.misses)
+	}
+	if metrics.contentions != 1 {
+		t.Errorf("Expected lock contention once, got %d", metrics.contentions)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// AllowedHosts maps partition IDs to STS hostnames that are accepted in
+// pre-signed URLs in addition to the ones resolved by the SDK, for example
+// gateway hostnames fronting STS.
+type AllowedHosts map[string][]string
+
+// LoadAllowedHostsFromFile reads a YAML (or JSON) file mapping partition IDs
+// to lists of additional STS hostnames:
+//
+//	aws:
+//	- sts.gateway.us-east-1.example.com
+//	aws-cn:
+//	- sts.gateway.cn-north-1.example.com
+func LoadAllowedHostsFromFile(filename string) (AllowedHosts, error) {
+	data, err := f.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %v", filename, err)
+	}
+
+	var hosts AllowedHosts
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("unable to parse file %s: %v", filename, err)
+	}
+	if err := hosts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid allowed hosts in file %s: %v", filename, err)
+	}
+	return hosts, nil
+}
+
+// Validate checks that every entry is a syntactically valid hostname.
+func (h AllowedHosts) Validate() error {
+	for partition, hosts := range h {
+		for _, host := range hosts {
+			if errs := validation.IsDNS1123Subdomain(strings.ToLower(host)); len(errs) > 0 {
+				return fmt.Errorf("%q in partition %s is not a valid hostname: %s", host, partition, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// merge adds the allowed hosts for partitionID into validSTShostnames,
+// de-duplicating against the hosts already present.
+func (h AllowedHosts) merge(partitionID string, validSTShostnames map[string]bool) {
+	for _, host := range h[partitionID] {
+		validSTShostnames[strings.ToLower(host)] = true
+	}
+}
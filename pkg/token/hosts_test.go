@@ -0,0 +1,79 @@
+package token
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadAllowedHostsFromFile(t *testing.T) {
+	tf, _, _ := getMocks()
+
+	tf.data = []byte(`aws:
+- sts.gateway.us-east-1.example.com
+- STS.Gateway.us-west-2.example.com
+aws-cn:
+- sts.gateway.cn-north-1.example.com
+`)
+	hosts, err := LoadAllowedHostsFromFile("hosts.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(hosts["aws"]) != 2 || len(hosts["aws-cn"]) != 1 {
+		t.Errorf("unexpected allowed hosts %v", hosts)
+	}
+
+	tf.data = []byte(`{"aws": ["sts.gateway.us-east-1.example.com"]}`)
+	hosts, err = LoadAllowedHostsFromFile("hosts.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(hosts["aws"]) != 1 {
+		t.Errorf("unexpected allowed hosts %v", hosts)
+	}
+}
+
+func TestLoadAllowedHostsFromFileErrors(t *testing.T) {
+	tf, _, _ := getMocks()
+
+	tf.err = errors.New("read failure")
+	_, err := LoadAllowedHostsFromFile("hosts.yaml")
+	errorContains(t, err, "unable to open file hosts.yaml")
+	tf.err = nil
+
+	tf.data = []byte(`aws: [`)
+	_, err = LoadAllowedHostsFromFile("hosts.yaml")
+	errorContains(t, err, "unable to parse file hosts.yaml")
+
+	tf.data = []byte(`aws:
+- https://sts.amazonaws.com/
+`)
+	_, err = LoadAllowedHostsFromFile("hosts.yaml")
+	errorContains(t, err, "is not a valid hostname")
+}
+
+func TestNewVerifierWithAllowedHosts(t *testing.T) {
+	v, err := NewVerifierWithOptions("", "aws", VerifierOptions{
+		AllowedHosts: AllowedHosts{
+			"aws":    {"STS.Gateway.us-east-1.example.com", "sts.amazonaws.com"},
+			"aws-cn": {"sts.gateway.cn-north-1.example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	verifier := v.(tokenVerifier)
+	if err := verifier.verifyHost("sts.gateway.us-east-1.example.com"); err != nil {
+		t.Errorf("allowed host should be valid: %v", err)
+	}
+	if err := verifier.verifyHost("sts.amazonaws.com"); err != nil {
+		t.Errorf("resolved host should still be valid: %v", err)
+	}
+	if err := verifier.verifyHost("sts.gateway.cn-north-1.example.com"); err == nil {
+		t.Errorf("host allowed for another partition should not be valid")
+	}
+
+	_, err = NewVerifierWithOptions("", "aws", VerifierOptions{
+		AllowedHosts: AllowedHosts{"aws": {"not a host"}},
+	})
+	errorContains(t, err, "is not a valid hostname")
+}
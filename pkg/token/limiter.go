@@ -0,0 +1,82 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// OverloadedError is returned by Verify when too many calls to STS are
+// already in flight and queued, so the token was not checked at all. Callers
+// should ask the client to retry later rather than deny it.
+type OverloadedError struct {
+	message string
+}
+
+func (e OverloadedError) Error() string {
+	return "too many concurrent calls to STS: " + e.message
+}
+
+// stsLimiter bounds the number of calls to STS in flight, queueing a bounded
+// number of calls over the limit until a call finishes.
+type stsLimiter struct {
+	slots     chan struct{}
+	queued    int64
+	maxQueued int64
+}
+
+func newSTSLimiter(maxConcurrent, maxQueued int) *stsLimiter {
+	return &stsLimiter{
+		slots:     make(chan struct{}, maxConcurrent),
+		maxQueued: int64(maxQueued),
+	}
+}
+
+// acquire waits until a call to STS may be made, or returns an
+// OverloadedError if the queue is full or ctx is done first. Every successful
+// acquire must be followed by a release. A nil limiter never waits.
+func (l *stsLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&l.queued, 1) > l.maxQueued {
+		atomic.AddInt64(&l.queued, -1)
+		return OverloadedError{message: "queue is full"}
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return OverloadedError{message: "timed out waiting in queue"}
+	}
+}
+
+// release ends a call to STS started after acquire.
+func (l *stsLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingRoundTripper tracks how many requests are in flight at once and
+// holds each one until release is closed.
+type blockingRoundTripper struct {
+	release     chan struct{}
+	started     chan struct{}
+	inFlight    int64
+	maxInFlight int64
+}
+
+func (rt *blockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := atomic.AddInt64(&rt.inFlight, 1)
+	for {
+		max := atomic.LoadInt64(&rt.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt64(&rt.maxInFlight, max, n) {
+			break
+		}
+	}
+	rt.started <- struct{}{}
+	<-rt.release
+	atomic.AddInt64(&rt.inFlight, -1)
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(jsonResponse("arn:aws:iam::123456789012:user/Alice", "123456789012", "Alice"))),
+	}, nil
+}
+
+func newLimitedVerifier(t *testing.T, rt http.RoundTripper, options VerifierOptions) tokenVerifier {
+	t.Helper()
+	v, err := NewVerifierWithOptions("", "aws", options)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	verifier := v.(tokenVerifier)
+	verifier.client = &http.Client{Transport: rt}
+	return verifier
+}
+
+func TestVerifyMaxConcurrentSTSCalls(t *testing.T) {
+	const limit, verifications = 3, 20
+	rt := &blockingRoundTripper{release: make(chan struct{}), started: make(chan struct{}, verifications)}
+	verifier := newLimitedVerifier(t, rt, VerifierOptions{MaxConcurrentSTSCalls: limit, MaxQueuedSTSCalls: verifications})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, verifications)
+	for i := 0; i < verifications; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := verifier.Verify(validToken)
+			errs <- err
+		}()
+	}
+	for i := 0; i < limit; i++ {
+		<-rt.started
+	}
+	// give the queued verifications a chance to exceed the limit
+	time.Sleep(10 * time.Millisecond)
+	close(rt.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected error to be nil was %q", err)
+		}
+	}
+	if rt.maxInFlight != limit {
+		t.Errorf("expected at most %d calls to STS in flight but got %d", limit, rt.maxInFlight)
+	}
+}
+
+func TestVerifyOverloaded(t *testing.T) {
+	rt := &blockingRoundTripper{release: make(chan struct{}), started: make(chan struct{}, 2)}
+	defer close(rt.release)
+	verifier := newLimitedVerifier(t, rt, VerifierOptions{MaxConcurrentSTSCalls: 1, MaxQueuedSTSCalls: 1, STSQueueTimeout: time.Hour})
+
+	go verifier.Verify(validToken)
+	<-rt.started
+	queued := make(chan error)
+	go func() {
+		_, err := verifier.Verify(validToken)
+		queued <- err
+	}()
+	for atomic.LoadInt64(&verifier.limiter.queued) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := verifier.Verify(validToken)
+	errorContains(t, err, "queue is full")
+	if _, ok := err.(OverloadedError); !ok {
+		t.Errorf("expected OverloadedError but got %T", err)
+	}
+	if result := verifyResult(err); result != VerifyOverloaded {
+		t.Errorf("expected result %q but got %q", VerifyOverloaded, result)
+	}
+	rt.release <- struct{}{}
+	<-rt.started
+	if err := <-queued; err != nil {
+		t.Errorf("expected queued verification to succeed but got %q", err)
+	}
+}
+
+func TestVerifyOverloadedQueueTimeout(t *testing.T) {
+	rt := &blockingRoundTripper{release: make(chan struct{}), started: make(chan struct{}, 1)}
+	defer close(rt.release)
+	verifier := newLimitedVerifier(t, rt, VerifierOptions{MaxConcurrentSTSCalls: 1, MaxQueuedSTSCalls: 1, STSQueueTimeout: time.Millisecond})
+
+	go verifier.Verify(validToken)
+	<-rt.started
+	_, err := verifier.Verify(validToken)
+	errorContains(t, err, "timed out waiting in queue")
+}
+
+func TestNewVerifierWithOptionsSTSQueueWithoutLimit(t *testing.T) {
+	_, err := NewVerifierWithOptions("", "aws", VerifierOptions{MaxQueuedSTSCalls: 1})
+	errorContains(t, err, "require MaxConcurrentSTSCalls")
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are the structured data attached to a log message. Errors are
+// attached under the "error" key.
+type Fields map[string]interface{}
+
+// Logger receives the log messages of Generators and Verifiers, so that
+// embedders can route them into their own logging pipeline.
+type Logger interface {
+	Debug(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+// logrusLogger is the default Logger, logging through the package-global
+// logrus logger.
+type logrusLogger struct{}
+
+func (logrusLogger) Debug(msg string, fields Fields) {
+	logrus.WithFields(logrus.Fields(fields)).Debug(msg)
+}
+
+func (logrusLogger) Warn(msg string, fields Fields) {
+	logrus.WithFields(logrus.Fields(fields)).Warn(msg)
+}
+
+func (logrusLogger) Error(msg string, fields Fields) {
+	logrus.WithFields(logrus.Fields(fields)).Error(msg)
+}
+
+// loggerOrDefault returns logger, or the logrus Logger if it is nil.
+func loggerOrDefault(logger Logger) Logger {
+	if logger == nil {
+		return logrusLogger{}
+	}
+	return logger
+}
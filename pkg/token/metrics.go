@@ -0,0 +1,84 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"time"
+)
+
+// Results of a call to Verify, as passed to MetricsRecorder.ObserveVerify.
+const (
+	VerifySuccess     = "success"
+	VerifyFormatError = "format_error"
+	VerifyExpired     = "expired"
+	VerifySTSError    = "sts_error"
+	VerifyOverloaded  = "overloaded"
+	VerifyOtherError  = "other_error"
+)
+
+// MetricsRecorder is notified of the outcome of every token verification, so
+// that callers can export them to their monitoring system.
+type MetricsRecorder interface {
+	// ObserveVerify is called once per call to Verify with its result.
+	ObserveVerify(result string)
+	// ObserveSTSLatency is called with the duration of each call to STS.
+	ObserveSTSLatency(latency time.Duration)
+}
+
+type noopMetricsRecorder struct{}
+
+func (noopMetricsRecorder) ObserveVerify(string)            {}
+func (noopMetricsRecorder) ObserveSTSLatency(time.Duration) {}
+
+// verifyResult classifies the error returned by Verify.
+func verifyResult(err error) string {
+	switch err := err.(type) {
+	case nil:
+		return VerifySuccess
+	case FormatError:
+		if err.expired {
+			return VerifyExpired
+		}
+		return VerifyFormatError
+	case STSError:
+		return VerifySTSError
+	case OverloadedError:
+		return VerifyOverloaded
+	default:
+		return VerifyOtherError
+	}
+}
+
+// CacheMetricsRecorder is notified of how a FileCacheProvider uses its cache,
+// to tell how effective the cache is.
+type CacheMetricsRecorder interface {
+	// ObserveCacheHit is called when Retrieve returns an unexpired cached
+	// credential.
+	ObserveCacheHit()
+	// ObserveCacheMiss is called when Retrieve falls through to the
+	// underlying provider.
+	ObserveCacheMiss()
+	// ObserveLockContention is called when the cache file is locked by
+	// someone else, and has to be waited for.
+	ObserveLockContention()
+}
+
+type noopCacheMetricsRecorder struct{}
+
+func (noopCacheMetricsRecorder) ObserveCacheHit()       {}
+func (noopCacheMetricsRecorder) ObserveCacheMiss()      {}
+func (noopCacheMetricsRecorder) ObserveLockContention() {}
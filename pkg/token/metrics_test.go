@@ -0,0 +1,53 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testMetricsRecorder struct {
+	results    map[string]int
+	stsLatency []time.Duration
+}
+
+func (m *testMetricsRecorder) ObserveVerify(result string) {
+	if m.results == nil {
+		m.results = map[string]int{}
+	}
+	m.results[result]++
+}
+
+func (m *testMetricsRecorder) ObserveSTSLatency(latency time.Duration) {
+	m.stsLatency = append(m.stsLatency, latency)
+}
+
+func TestVerifyMetrics(t *testing.T) {
+	cases := []struct {
+		name    string
+		token   string
+		status  int
+		body    string
+		err     error
+		result  string
+		stsCall bool
+	}{
+		{"success", validToken, 200, jsonResponse("arn:aws:iam::123456789012:user/Alice", "123456789012", "Alice"), nil, VerifySuccess, true},
+		{"format", "k8s-aws-v2.asdfasdfa", 200, "", nil, VerifyFormatError, false},
+		{"expired", toToken("https://sts.amazonaws.com/?action=GetCallerIdentity&x-amz-signedheaders=x-k8s-aws-id&x-amz-date=19900422T010203Z&x-amz-expires=60"), 200, "", nil, VerifyExpired, false},
+		{"sts", validToken, 0, "", errors.New("an error"), VerifySTSError, true},
+	}
+
+	for _, c := range cases {
+		recorder := &testMetricsRecorder{}
+		verifier := newVerifier("aws", c.status, c.body, c.err).(tokenVerifier)
+		verifier.metrics = recorder
+		verifier.Verify(c.token)
+		if len(recorder.results) != 1 || recorder.results[c.result] != 1 {
+			t.Errorf("%s: expected a single %q result but got %v", c.name, c.result, recorder.results)
+		}
+		if c.stsCall != (len(recorder.stsLatency) == 1) {
+			t.Errorf("%s: unexpected STS latency observations %v", c.name, recorder.stsLatency)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// net/http keeps only 2 idle connections per host by default, which
+	// isn't enough to keep connections to STS warm under concurrent load.
+	defaultMaxIdleConns        = 256
+	defaultMaxIdleConnsPerHost = 32
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// ConnectionPoolOptions tunes the connections a Verifier keeps open to STS.
+// The zero value uses sane defaults for a verifier calling STS in several
+// regions.
+type ConnectionPoolOptions struct {
+	// MaxIdleConns caps the idle connections kept across all STS hosts of a
+	// client. Zero means 256.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections kept to each STS host.
+	// Zero means 32.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept before being
+	// closed. Zero means 90 seconds.
+	IdleConnTimeout time.Duration
+	// DedicatedRegions are regions whose STS endpoints get a client, and so a
+	// pool, of their own. Traffic to other regions then can't evict their
+	// warm connections.
+	DedicatedRegions []string
+}
+
+// validate checks that no limit is negative.
+func (o ConnectionPoolOptions) validate() error {
+	if o.MaxIdleConns < 0 {
+		return fmt.Errorf("MaxIdleConns must not be negative, got %d", o.MaxIdleConns)
+	}
+	if o.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("MaxIdleConnsPerHost must not be negative, got %d", o.MaxIdleConnsPerHost)
+	}
+	if o.IdleConnTimeout < 0 {
+		return fmt.Errorf("IdleConnTimeout must not be negative, got %s", o.IdleConnTimeout)
+	}
+	return nil
+}
+
+// newTransport returns a transport for calling STS, which goes through the
+// proxy set by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	return transport
+}
+
+// newClient returns a client for calling STS with a pool configured by o.
+func (o ConnectionPoolOptions) newClient() *http.Client {
+	transport := newTransport()
+	transport.MaxIdleConns = defaultMaxIdleConns
+	if o.MaxIdleConns > 0 {
+		transport.MaxIdleConns = o.MaxIdleConns
+	}
+	transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if o.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	transport.IdleConnTimeout = defaultIdleConnTimeout
+	if o.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = o.IdleConnTimeout
+	}
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: doNotFollowRedirects,
+	}
+}
+
+// doNotFollowRedirects makes a client return redirects from STS as is.
+func doNotFollowRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// clientFor returns the client for calling STS in region.
+func (v tokenVerifier) clientFor(region string) *http.Client {
+	if client, ok := v.regionClients[region]; ok {
+		return client
+	}
+	return v.client
+}
+
+// parseProxyURL parses the URL of a proxy to send calls to STS through.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ProxyURL %q: %v", rawURL, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("ProxyURL %q must be an http, https or socks5 URL", rawURL)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("ProxyURL %q has no host", rawURL)
+	}
+	return proxyURL, nil
+}
+
+// proxyFunc returns a Proxy function for an http.Transport that sends
+// requests through proxyURL, except to hosts excluded by noProxy. Like
+// NO_PROXY, noProxy is a comma-separated list of hostnames, each also
+// excluding its subdomains, or "*" to exclude every host.
+func proxyFunc(proxyURL *url.URL, noProxy string) func(*http.Request) (*url.URL, error) {
+	var excluded []string
+	for _, host := range strings.Split(noProxy, ",") {
+		if host = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(host), ".")); host != "" {
+			excluded = append(excluded, host)
+		}
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, exclude := range excluded {
+			if exclude == "*" || host == exclude || strings.HasSuffix(host, "."+exclude) {
+				return nil, nil
+			}
+		}
+		return proxyURL, nil
+	}
+}
+
+// noProxyFromEnvironment returns the hosts excluded from proxying by the
+// NO_PROXY environment variable.
+func noProxyFromEnvironment() string {
+	if noProxy := e.Getenv("NO_PROXY"); noProxy != "" {
+		return noProxy
+	}
+	return e.Getenv("no_proxy")
+}
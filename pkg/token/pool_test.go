@@ -0,0 +1,190 @@
+package token
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewVerifierWithOptionsConnectionPool(t *testing.T) {
+	v, err := NewVerifierWithOptions("", "aws", VerifierOptions{
+		ConnectionPool: ConnectionPoolOptions{
+			MaxIdleConnsPerHost: 8,
+			DedicatedRegions:    []string{"us-west-2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	verifier := v.(tokenVerifier)
+	transport := verifier.client.Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 8 {
+		t.Errorf("expected MaxIdleConnsPerHost to be 8 but was %d", transport.MaxIdleConnsPerHost)
+	}
+	if transport.MaxIdleConns != defaultMaxIdleConns || transport.IdleConnTimeout != defaultIdleConnTimeout {
+		t.Errorf("expected default MaxIdleConns and IdleConnTimeout but got %d and %s", transport.MaxIdleConns, transport.IdleConnTimeout)
+	}
+	if verifier.clientFor("us-west-2") == verifier.client {
+		t.Error("expected us-west-2 to have a dedicated client")
+	}
+	if verifier.clientFor("us-east-1") != verifier.client {
+		t.Error("expected us-east-1 to use the shared client")
+	}
+	if verifier.clientFor("us-west-2").CheckRedirect == nil {
+		t.Error("expected dedicated clients not to follow redirects")
+	}
+}
+
+func TestNewVerifierWithOptionsInvalidConnectionPool(t *testing.T) {
+	cases := []struct {
+		options     ConnectionPoolOptions
+		expectedErr string
+	}{
+		{ConnectionPoolOptions{MaxIdleConns: -1}, "MaxIdleConns must not be negative"},
+		{ConnectionPoolOptions{MaxIdleConnsPerHost: -1}, "MaxIdleConnsPerHost must not be negative"},
+		{ConnectionPoolOptions{IdleConnTimeout: -time.Second}, "IdleConnTimeout must not be negative"},
+	}
+	for _, c := range cases {
+		_, err := NewVerifierWithOptions("", "aws", VerifierOptions{ConnectionPool: c.options})
+		errorContains(t, err, c.expectedErr)
+	}
+}
+
+func TestNewVerifierWithOptionsProxyURL(t *testing.T) {
+	var connects []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			connects = append(connects, r.Host)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	_, te, _ := getMocks()
+	te.values["NO_PROXY"] = "vpce.amazonaws.com, .internal.example.com"
+	v, err := NewVerifierWithOptions("", "aws", VerifierOptions{
+		ProxyURL:       proxy.URL,
+		ConnectionPool: ConnectionPoolOptions{DedicatedRegions: []string{"us-west-2"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = v.Verify(validToken)
+	assertSTSError(t, err)
+	if len(connects) != 1 || connects[0] != "sts.amazonaws.com:443" {
+		t.Errorf("expected the call to STS to go through the proxy but it saw %v", connects)
+	}
+
+	verifier := v.(tokenVerifier)
+	for _, client := range []*http.Client{verifier.client, verifier.clientFor("us-west-2")} {
+		proxyFor := client.Transport.(*http.Transport).Proxy
+		cases := []struct {
+			host    string
+			proxied bool
+		}{
+			{"sts.us-west-2.amazonaws.com", true},
+			{"vpce.amazonaws.com", false},
+			{"vpce-0123-abcd.sts.us-west-2.vpce.amazonaws.com", false},
+			{"sts.internal.example.com", false},
+			{"internal.example.com.evil.com", true},
+		}
+		for _, c := range cases {
+			proxyURL, err := proxyFor(&http.Request{URL: &url.URL{Scheme: "https", Host: c.host}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if c.proxied != (proxyURL != nil) {
+				t.Errorf("%s: expected to be proxied %t but got proxy %v", c.host, c.proxied, proxyURL)
+			}
+		}
+	}
+}
+
+func TestNewVerifierWithOptionsInvalidProxyURL(t *testing.T) {
+	cases := []struct {
+		proxyURL    string
+		expectedErr string
+	}{
+		{"://proxy", "invalid ProxyURL"},
+		{"ftp://proxy.example.com", "must be an http, https or socks5 URL"},
+		{"http://", "has no host"},
+	}
+	for _, c := range cases {
+		_, err := NewVerifierWithOptions("", "aws", VerifierOptions{ProxyURL: c.proxyURL})
+		errorContains(t, err, c.expectedErr)
+	}
+}
+
+func TestNewVerifierHonorsProxyEnvironment(t *testing.T) {
+	transport := NewVerifier("", "aws").(tokenVerifier).client.Transport.(*http.Transport)
+	if transport.Proxy == nil {
+		t.Error("expected the default transport to honor the proxy environment variables")
+	}
+}
+
+// stsHosts starts n TLS servers standing in for the STS endpoints of n
+// regions, and returns a pre-signed URL for each keyed by region.
+func stsHosts(b *testing.B, n int) (map[string]*url.URL, *x509.CertPool) {
+	urls := map[string]*url.URL{}
+	roots := x509.NewCertPool()
+	for i := 0; i < n; i++ {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(jsonResponse("arn:aws:iam::123456789012:user/Alice", "123456789012", "Alice")))
+		}))
+		b.Cleanup(ts.Close)
+		roots.AddCert(ts.Certificate())
+		u, _ := url.Parse(ts.URL + "/?Action=GetCallerIdentity")
+		urls[fmt.Sprintf("region-%d", i)] = u
+	}
+	return urls, roots
+}
+
+// benchmarkFanOut calls STS concurrently, spreading the calls over the
+// regions of urls.
+func benchmarkFanOut(b *testing.B, v tokenVerifier, urls map[string]*url.URL) {
+	regions := make([]string, 0, len(urls))
+	for region := range urls {
+		regions = append(regions, region)
+	}
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			region := regions[i%len(regions)]
+			i++
+			if _, _, err := v.getCallerIdentity(urls[region], region, "cluster"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkVerifierSingleClient(b *testing.B) {
+	urls, roots := stsHosts(b, 8)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	v := NewVerifier("cluster", "aws").(tokenVerifier)
+	v.client.Transport = transport
+	benchmarkFanOut(b, v, urls)
+}
+
+func BenchmarkVerifierPooledClients(b *testing.B) {
+	urls, roots := stsHosts(b, 8)
+	options := ConnectionPoolOptions{}
+	for region := range urls {
+		options.DedicatedRegions = append(options.DedicatedRegions, region)
+	}
+	v, _ := NewVerifierWithOptions("cluster", "aws", VerifierOptions{ConnectionPool: options})
+	verifier := v.(tokenVerifier)
+	verifier.client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: roots}
+	for _, client := range verifier.regionClients {
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	benchmarkFanOut(b, verifier, urls)
+}
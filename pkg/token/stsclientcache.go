@@ -0,0 +1,81 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// stsClientKey identifies the options an STS client built by a generator
+// depends on, with the profile, region and endpoint mode already resolved.
+type stsClientKey struct {
+	region               string
+	profile              string
+	assumeRoleARN        string
+	assumeRoleExternalID string
+	sessionName          string
+	userAgentSuffix      string
+	endpointMode         STSEndpointResolutionMode
+	disableIMDS          bool
+	maxRetries           int
+	// cacheClusterID is the cluster ID the credential cache is keyed on,
+	// if the generator caches credentials on disk.
+	cacheClusterID string
+}
+
+// cachedSTSClient is an STS client along with the session it was built from.
+type cachedSTSClient struct {
+	client  *sts.Client
+	session aws.Config
+}
+
+// stsClientCache keeps the STS clients a generator builds, so that repeated
+// calls reuse their credentials and connections. The clients' credentials
+// are still refreshed by the SDK once they expire.
+type stsClientCache struct {
+	lock    sync.Mutex
+	clients map[stsClientKey]cachedSTSClient
+}
+
+func newSTSClientCache() *stsClientCache {
+	return &stsClientCache{clients: map[stsClientKey]cachedSTSClient{}}
+}
+
+// get returns the client cached for key, if any. It is safe to call on a nil
+// cache, which never has a client.
+func (c *stsClientCache) get(key stsClientKey) (cachedSTSClient, bool) {
+	if c == nil {
+		return cachedSTSClient{}, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	client, ok := c.clients[key]
+	return client, ok
+}
+
+// put caches client for key. It does nothing on a nil cache.
+func (c *stsClientCache) put(key stsClientKey, client cachedSTSClient) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.clients[key] = client
+}
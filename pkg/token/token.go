@@ -18,15 +18,17 @@ package token
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"sigs.k8s.io/aws-iam-authenticator/pkg"
@@ -34,14 +36,18 @@ import (
 	"sigs.k8s.io/aws-iam-authenticator/pkg/partitions"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
 	sdkMiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	smithymiddleware "github.com/aws/smithy-go/middleware"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
-	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientauthv1alpha1 "k8s.io/client-go/pkg/apis/clientauthentication/v1alpha1"
 )
@@ -49,7 +55,9 @@ import (
 // Identity is returned on successful Verify() results. It contains a parsed
 // version of the AWS identity used to create the token.
 type Identity struct {
-	// ARN is the raw Amazon Resource Name returned by sts:GetCallerIdentity
+	// ARN is the raw Amazon Resource Name returned by sts:GetCallerIdentity,
+	// e.g. "arn:aws:sts::ACCOUNTID:assumed-role/ROLENAME/SESSIONNAME" for an
+	// assumed role.
 	ARN string
 
 	// CanonicalARN is the Amazon Resource Name converted to a more canonical
@@ -76,25 +84,176 @@ type Identity struct {
 	// in conjuction with CloudTrail to determine the identity of the individual
 	// if the individual assumed an IAM role before making the request.
 	AccessKeyID string
+
+	// PrincipalType is the kind of AWS principal that created the token.
+	PrincipalType PrincipalType
+
+	// RoleName is the name of the IAM role from CanonicalARN (e.g.,
+	// "ROLENAME"), or "" if the identity isn't a role.
+	RoleName string
+
+	// Region is the region the token was signed for, from the credential
+	// scope of its pre-signed URL or else from its regional STS hostname, or
+	// "" if neither names one.
+	Region string
+
+	// CredentialScopeDate is the date of the credential scope the token was
+	// signed with, or the zero time if it has none.
+	CredentialScopeDate time.Time
+}
+
+// PrincipalType is the kind of AWS principal an Identity is for.
+type PrincipalType string
+
+const (
+	// PrincipalTypeUnknown is an ARN the authenticator doesn't classify.
+	PrincipalTypeUnknown PrincipalType = "Unknown"
+	// PrincipalTypeRoot is an AWS account root user, like
+	// "arn:aws:iam::ACCOUNTID:root".
+	PrincipalTypeRoot PrincipalType = "Root"
+	// PrincipalTypeIAMUser is an IAM user, like
+	// "arn:aws:iam::ACCOUNTID:user/NAME".
+	PrincipalTypeIAMUser PrincipalType = "IAMUser"
+	// PrincipalTypeAssumedRole is a session of an assumed IAM role, like
+	// "arn:aws:sts::ACCOUNTID:assumed-role/ROLENAME/SESSIONNAME".
+	PrincipalTypeAssumedRole PrincipalType = "AssumedRole"
+	// PrincipalTypeFederatedUser is a federated user session, like
+	// "arn:aws:sts::ACCOUNTID:federated-user/NAME".
+	PrincipalTypeFederatedUser PrincipalType = "FederatedUser"
+)
+
+// roleName returns the name of the IAM role canonicalARN is for, or "" if it
+// isn't for a role.
+func roleName(canonicalARN string) string {
+	parsed, err := awsarn.Parse(canonicalARN)
+	if err != nil || parsed.Service != "iam" || !strings.HasPrefix(parsed.Resource, "role/") {
+		return ""
+	}
+	return strings.TrimPrefix(parsed.Resource, "role/")
+}
+
+// principalType classifies the ARN returned by sts:GetCallerIdentity. Assumed
+// roles are only recognized along with the session name STS returns for them.
+func principalType(identityARN string, sessionName string) PrincipalType {
+	parsed, err := awsarn.Parse(identityARN)
+	if err != nil {
+		return PrincipalTypeUnknown
+	}
+	resource := strings.SplitN(parsed.Resource, "/", 2)[0]
+	switch {
+	case parsed.Service == "iam" && resource == "root":
+		return PrincipalTypeRoot
+	case parsed.Service == "iam" && resource == "user":
+		return PrincipalTypeIAMUser
+	case parsed.Service == "sts" && resource == "assumed-role" && sessionName != "":
+		return PrincipalTypeAssumedRole
+	case parsed.Service == "sts" && resource == "federated-user":
+		return PrincipalTypeFederatedUser
+	}
+	return PrincipalTypeUnknown
 }
 
 const (
 	// The actual token expiration (presigned STS urls are valid for 15 minutes after timestamp in x-amz-date).
 	presignedURLExpiration = 15 * time.Minute
+	// The default token expiration, a minute short of the actual one for some cushion.
+	defaultTokenExpiration = presignedURLExpiration - time.Minute
 	v1Prefix               = "k8s-aws-v1."
+	v2Prefix               = "k8s-aws-v2."
 	maxTokenLenBytes       = 1024 * 4
-	clusterIDHeader        = "x-k8s-aws-id"
+	// the shortest pre-signed URL a token could carry
+	minPresignedURL = "https://?action=GetCallerIdentity"
+	clusterIDHeader = "x-k8s-aws-id"
 	// Format of the X-Amz-Date header used for expiration
 	// https://golang.org/pkg/time/#pkg-constants
 	dateHeaderFormat = "20060102T150405Z"
+	// Format of the date in the X-Amz-Credential scope
+	credentialScopeDateFormat = "20060102"
+	// The ExecCredential apiVersion emitted by FormatJSON
+	execCredentialAPIVersion = "client.authentication.k8s.io/v1alpha1"
+	execCredentialKind       = "ExecCredential"
+	// Environment variable client-go uses to pass exec plugin information
+	execInfoEnv = "KUBERNETES_EXEC_INFO"
+	// Environment variable the AWS SDKs use to select the STS endpoint
+	stsRegionalEndpointsEnv = "AWS_STS_REGIONAL_ENDPOINTS"
+	// The SDK's region for the global STS endpoint, sts.amazonaws.com
+	stsGlobalRegion = "aws-global"
+)
+
+// STSEndpointResolutionMode selects which STS endpoint a token is presigned
+// for, like the AWS SDKs' sts_regional_endpoints setting.
+type STSEndpointResolutionMode string
+
+const (
+	// STSRegionalEndpoint presigns tokens for the STS endpoint of the region
+	// they are signed in.
+	STSRegionalEndpoint STSEndpointResolutionMode = "regional"
+	// STSLegacyEndpoint presigns tokens for the global STS endpoint when
+	// signing in one of the regions that used it before regional endpoints
+	// existed, and for the regional endpoint otherwise.
+	STSLegacyEndpoint STSEndpointResolutionMode = "legacy"
+)
+
+// userAgentSuffixPattern matches the UserAgentSuffix values that are safe to
+// put in a User-Agent header.
+var userAgentSuffixPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)?$`)
+
+// stsLegacyGlobalRegions are the regions STSLegacyEndpoint sends to the
+// global STS endpoint.
+var stsLegacyGlobalRegions = map[string]bool{
+	"ap-northeast-1": true,
+	"ap-south-1":     true,
+	"ap-southeast-1": true,
+	"ap-southeast-2": true,
+	"ca-central-1":   true,
+	"eu-central-1":   true,
+	"eu-north-1":     true,
+	"eu-west-1":      true,
+	"eu-west-2":      true,
+	"eu-west-3":      true,
+	"sa-east-1":      true,
+	"us-east-1":      true,
+	"us-east-2":      true,
+	"us-west-1":      true,
+	"us-west-2":      true,
+}
+
+// The versions of the token format a Generator can emit.
+const (
+	// TokenV1 tokens are "k8s-aws-v1." followed by the base64url encoded
+	// pre-signed URL.
+	TokenV1 = 1
+	// TokenV2 tokens are "k8s-aws-v2." followed by the base64url encoded JSON
+	// of a v2Envelope, which carries the region and cluster ID along with the
+	// pre-signed URL.
+	TokenV2 = 2
 )
 
+// v2Envelope is what a TokenV2 token encodes. Neither Region nor ClusterID is
+// covered by the URL's signature, so the verifier checks Region against the
+// signed credential scope and sends ClusterID to STS in the signed header.
+type v2Envelope struct {
+	URL       string `json:"url"`
+	Region    string `json:"region"`
+	ClusterID string `json:"clusterID"`
+}
+
 // Token is generated and used by Kubernetes client-go to authenticate with a Kubernetes cluster.
 type Token struct {
 	Token      string
 	Expiration time.Time
 }
 
+// TokenMetadata describes the principal and region a generated token was signed with.
+type TokenMetadata struct {
+	// AccessKeyID is the AWS Access Key ID of the credentials that signed the token.
+	AccessKeyID string
+	// AssumedRoleARN is the role assumed before signing the token, or "" if none was.
+	AssumedRoleARN string
+	// RegionUsed is the region of the STS endpoint the token is valid for.
+	RegionUsed string
+}
+
 // GetTokenOptions is passed to GetWithOptions to provide an extensible get token interface
 type GetTokenOptions struct {
 	Region               string
@@ -103,6 +262,32 @@ type GetTokenOptions struct {
 	AssumeRoleExternalID string
 	SessionName          string
 	Session              aws.Config
+	// Profile is the shared config profile to load credentials from. When set
+	// it takes precedence over AWS_PROFILE, both for loading and cache keying.
+	Profile string
+	// DisableIMDS prevents credentials and region from ever being looked up in
+	// the EC2 instance metadata, e.g. so that a pod without its own credentials
+	// doesn't silently sign tokens as the node role.
+	DisableIMDS bool
+	// STSEndpointResolutionMode selects which STS endpoint the token is
+	// presigned for. When empty, AWS_STS_REGIONAL_ENDPOINTS is consulted,
+	// and STSRegionalEndpoint is used if that isn't set either.
+	STSEndpointResolutionMode STSEndpointResolutionMode
+	// UserAgentSuffix is appended to the User-Agent of calls made to STS, so
+	// that they can be attributed to the embedding tool in CloudTrail. It must
+	// be of the form name or name/version.
+	UserAgentSuffix string
+	// STSClient, when set, is used to presign the token instead of building a
+	// client from the options. The role in AssumeRoleARN is still assumed
+	// with it, but Region, Profile, Session and STSEndpointResolutionMode
+	// are ignored, as are MaxRetries and Retryer.
+	STSClient *sts.Client
+	// MaxRetries is how many times calls to STS that fail with a retryable
+	// error, such as throttling, are retried. Zero uses the SDK's default.
+	MaxRetries int
+	// Retryer replaces the SDK's standard retryer for calls to STS, and takes
+	// precedence over MaxRetries.
+	Retryer aws.Retryer
 }
 
 // FormatError is returned when there is a problem with token that is
@@ -110,6 +295,7 @@ type GetTokenOptions struct {
 // else that prevents the sts call from being made.
 type FormatError struct {
 	message string
+	expired bool
 }
 
 func (e FormatError) Error() string {
@@ -144,6 +330,25 @@ var parameterWhitelist = map[string]bool{
 	"x-amz-user-agent":     true,
 }
 
+// headers a pre-signed URL may sign by default, besides the cluster ID header
+var signedHeaderWhitelist = map[string]bool{
+	"host": true,
+}
+
+// headers that describe a request body or override the HTTP method. A
+// pre-signed GET GetCallerIdentity request never signs these, so they are
+// rejected even when configured as additional signed headers.
+var methodHintHeaders = map[string]bool{
+	"content-length":         true,
+	"content-md5":            true,
+	"content-type":           true,
+	"transfer-encoding":      true,
+	"x-amz-content-sha256":   true,
+	"x-http-method":          true,
+	"x-http-method-override": true,
+	"x-method-override":      true,
+}
+
 // this is the result type from the GetCallerIdentity endpoint
 type getCallerIdentityWrapper struct {
 	GetCallerIdentityResponse struct {
@@ -168,6 +373,8 @@ type Generator interface {
 	GetWithRoleForSession(ctx context.Context, clusterID string, roleARN string, sess aws.Config) (Token, error)
 	// Get a token using the provided options
 	GetWithOptions(ctx context.Context, options *GetTokenOptions) (Token, error)
+	// GetWithMetadata gets a token using the provided options and returns what it was signed with
+	GetWithMetadata(ctx context.Context, options *GetTokenOptions) (Token, TokenMetadata, error)
 	// GetWithSTS returns a token valid for clusterID using the given STS client.
 	GetWithSTS(ctx context.Context, clusterID string, client *sts.Client) (Token, error)
 	// FormatJSON returns the client auth formatted json for the ExecCredential auth
@@ -177,16 +384,124 @@ type Generator interface {
 type generator struct {
 	forwardSessionName bool
 	cache              bool
+	timeout            time.Duration
+	prefix             string
+	header             string
+	version            int
+	expiration         time.Duration
+	logger             Logger
+	clients            *stsClientCache
+}
+
+// GeneratorOptions is passed to NewGeneratorWithOptions to provide an extensible
+// way of configuring a Generator.
+type GeneratorOptions struct {
+	// ForwardSessionName carries the session name of a federated identity
+	// through onto the assumed role session.
+	ForwardSessionName bool
+	// Cache enables the on disk credential cache.
+	Cache bool
+	// Timeout bounds getting a token when the passed context has no deadline
+	// of its own. Zero means no timeout.
+	Timeout time.Duration
+	// TokenPrefix replaces the "k8s-aws-v1." prefix of generated tokens. It
+	// must match the TokenPrefix of the Verifier the tokens are sent to.
+	TokenPrefix string
+	// ClusterIDHeader replaces the "x-k8s-aws-id" header the cluster ID is
+	// signed in. It must match the ClusterIDHeader of the Verifier the tokens
+	// are sent to.
+	ClusterIDHeader string
+	// TokenVersion is the token format to emit, TokenV1 or TokenV2. Zero
+	// means TokenV1. TokenPrefix only applies to TokenV1 tokens.
+	TokenVersion int
+	// TokenExpiration is how long generated tokens are valid for, which is
+	// also signed into their X-Amz-Expires parameter. Zero means 14 minutes,
+	// the longest allowed, a minute short of the 15 minutes STS accepts a
+	// pre-signed URL for.
+	TokenExpiration time.Duration
+	// Logger receives the generator's log messages. If nil, they are logged
+	// with logrus.
+	Logger Logger
 }
 
 // NewGenerator creates a Generator and returns it.
 func NewGenerator(forwardSessionName bool, cache bool) (Generator, error) {
+	return NewGeneratorWithOptions(GeneratorOptions{
+		ForwardSessionName: forwardSessionName,
+		Cache:              cache,
+	})
+}
+
+// NewGeneratorWithOptions creates a Generator configured by options and returns it.
+func NewGeneratorWithOptions(options GeneratorOptions) (Generator, error) {
+	if options.Timeout < 0 {
+		return nil, fmt.Errorf("Timeout must not be negative, got %s", options.Timeout)
+	}
+	if options.TokenVersion < 0 || options.TokenVersion > TokenV2 {
+		return nil, fmt.Errorf("unknown TokenVersion %d", options.TokenVersion)
+	}
+	if options.TokenExpiration != 0 && (options.TokenExpiration < time.Second || options.TokenExpiration > defaultTokenExpiration) {
+		return nil, fmt.Errorf("TokenExpiration must be between 1s and %s, got %s", defaultTokenExpiration, options.TokenExpiration)
+	}
 	return generator{
-		forwardSessionName: forwardSessionName,
-		cache:              cache,
+		forwardSessionName: options.ForwardSessionName,
+		cache:              options.Cache,
+		timeout:            options.Timeout,
+		prefix:             options.TokenPrefix,
+		header:             strings.ToLower(options.ClusterIDHeader),
+		version:            options.TokenVersion,
+		expiration:         options.TokenExpiration,
+		clients:            newSTSClientCache(),
+		logger:             loggerOrDefault(options.Logger),
 	}, nil
 }
 
+// log returns the generator's Logger.
+func (g generator) log() Logger {
+	return loggerOrDefault(g.logger)
+}
+
+// tokenPrefix returns the prefix of generated tokens.
+func (g generator) tokenPrefix() string {
+	if g.prefix == "" {
+		return v1Prefix
+	}
+	return g.prefix
+}
+
+// clusterIDHeader returns the header the cluster ID is signed in.
+func (g generator) clusterIDHeader() string {
+	if g.header == "" {
+		return clusterIDHeader
+	}
+	return g.header
+}
+
+// tokenExpiration returns how long generated tokens are valid for.
+func (g generator) tokenExpiration() time.Duration {
+	if g.expiration == 0 {
+		return defaultTokenExpiration
+	}
+	return g.expiration
+}
+
+// withTimeout applies the generator's default timeout to ctx, unless ctx
+// already has a deadline.
+func (g generator) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || g.timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, g.timeout)
+}
+
+// timeoutError replaces err with a clearer error if ctx ran out of time.
+func timeoutError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out getting token: %v", err)
+	}
+	return err
+}
+
 // Get uses the directly available AWS credentials to return a token valid for
 // clusterID. It follows the default AWS credential handling behavior.
 func (g generator) Get(ctx context.Context, clusterID string) (Token, error) {
@@ -224,20 +539,109 @@ func StdinStderrTokenProvider() (string, error) {
 // If no session has been passed in options, it will build a new session. If an
 // AssumeRoleARN was passed in then assume the role for the session.
 func (g generator) GetWithOptions(ctx context.Context, options *GetTokenOptions) (Token, error) {
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+
+	stsClient, clientOptions, err := g.stsClientWithOptions(ctx, options)
+	if err != nil {
+		return Token{}, ssoSessionError(timeoutError(ctx, err), options.Profile)
+	}
+	tok, err := g.getWithSTS(ctx, options.ClusterID, stsClient, clientOptions)
+	if err != nil {
+		return Token{}, ssoSessionError(err, options.Profile)
+	}
+	return tok, nil
+}
+
+// ssoSessionError replaces err with a clearer error if the credentials failed
+// to load because the AWS SSO session has expired.
+func ssoSessionError(err error, profile string) error {
+	var invalidToken *ssocreds.InvalidTokenError
+	if !errors.As(err, &invalidToken) {
+		return err
+	}
+	login := "aws sso login"
+	if profile = resolveProfile(profile); profile != config.DefaultSharedConfigProfile {
+		login += " --profile " + profile
+	}
+	return fmt.Errorf("SSO session expired, run %s: %v", login, err)
+}
+
+// GetWithMetadata behaves like GetWithOptions, but also returns the metadata
+// of the principal and region the token was signed with.
+func (g generator) GetWithMetadata(ctx context.Context, options *GetTokenOptions) (Token, TokenMetadata, error) {
+	tok, err := g.GetWithOptions(ctx, options)
+	if err != nil {
+		return Token{}, TokenMetadata{}, err
+	}
+	metadata, err := tokenMetadata(tok, g.tokenPrefix())
+	if err != nil {
+		return Token{}, TokenMetadata{}, err
+	}
+	metadata.AssumedRoleARN = options.AssumeRoleARN
+	return tok, metadata, nil
+}
+
+// stsClientWithOptions builds the STS client used to presign the token, along
+// with options to apply to the client when presigning.
+func (g generator) stsClientWithOptions(ctx context.Context, options *GetTokenOptions) (*sts.Client, []func(*sts.Options), error) {
 	if options.ClusterID == "" {
-		return Token{}, fmt.Errorf("ClusterID is required")
+		return nil, nil, fmt.Errorf("ClusterID is required")
+	}
+	if options.UserAgentSuffix != "" && !userAgentSuffixPattern.MatchString(options.UserAgentSuffix) {
+		return nil, nil, fmt.Errorf("UserAgentSuffix %q must be of the form name or name/version", options.UserAgentSuffix)
+	}
+	if options.MaxRetries < 0 {
+		return nil, nil, fmt.Errorf("MaxRetries must not be negative, got %d", options.MaxRetries)
+	}
+	if options.STSClient != nil {
+		return g.wrapSTSClient(ctx, options)
+	}
+	endpointMode := resolveSTSEndpointResolutionMode(options.STSEndpointResolutionMode)
+	if endpointMode != STSRegionalEndpoint && endpointMode != STSLegacyEndpoint {
+		return nil, nil, fmt.Errorf("unknown STS endpoint resolution mode %q", endpointMode)
+	}
+
+	// resolve the profile once, so that loading credentials and keying the
+	// caches agree even if the environment changes concurrently
+	profile := resolveProfile(options.Profile)
+	region := resolveRegion(options.Region)
+	// only clients built from a session loaded here, with a retryer of our
+	// own, are reused
+	reuseClient := options.Session.Credentials == nil && options.Retryer == nil
+	clientKey := stsClientKey{
+		region:               region,
+		profile:              profile,
+		assumeRoleARN:        options.AssumeRoleARN,
+		assumeRoleExternalID: options.AssumeRoleExternalID,
+		sessionName:          options.SessionName,
+		userAgentSuffix:      options.UserAgentSuffix,
+		endpointMode:         endpointMode,
+		disableIMDS:          options.DisableIMDS,
+		maxRetries:           options.MaxRetries,
+	}
+	if g.cache {
+		clientKey.cacheClusterID = options.ClusterID
+	}
+	if reuseClient {
+		if cached, ok := g.clients.get(clientKey); ok {
+			options.Session = cached.session
+			return cached.client, nil, nil
+		}
 	}
 
 	if options.Session.Credentials == nil {
 		// create a session with the "base" credentials available
 		// (from environment variable, profile files, EC2 metadata, etc)
+		var usesIMDS, usesSSO bool
 		sess, err := config.LoadDefaultConfig(ctx, func(loadOptions *config.LoadOptions) error {
 			loadOptions.APIOptions = append(loadOptions.APIOptions, sdkMiddleware.AddUserAgentKeyValue("aws-iam-authenticator", pkg.Version))
-			if options.Region != "" {
-				loadOptions.Region = options.Region
+			loadOptions.SharedConfigProfile = profile
+			if region != "" {
+				loadOptions.Region = region
 				loadOptions.EndpointCredentialOptions = func(endpointOptions *endpointcreds.Options) {
-					if endpoint, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(options.Region, sts.EndpointResolverOptions{}); err != nil {
-						logrus.WithError(err).Errorf("failed to resolve endpoint")
+					if endpoint, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(region, sts.EndpointResolverOptions{}); err != nil {
+						g.log().Error("failed to resolve endpoint", Fields{"error": err})
 					} else {
 						endpointOptions.Endpoint = endpoint.URL
 					}
@@ -246,84 +650,262 @@ func (g generator) GetWithOptions(ctx context.Context, options *GetTokenOptions)
 			loadOptions.AssumeRoleCredentialOptions = func(assumeRoleOptions *stscreds.AssumeRoleOptions) {
 				assumeRoleOptions.TokenProvider = StdinStderrTokenProvider
 			}
+			// only called if the profile gets its credentials from AWS SSO
+			loadOptions.SSOProviderOptions = func(*ssocreds.Options) {
+				usesSSO = true
+			}
+			if options.DisableIMDS {
+				// only called if the credential chain falls through to the EC2 instance role
+				loadOptions.EC2RoleCredentialOptions = func(ec2RoleOptions *ec2rolecreds.Options) {
+					usesIMDS = true
+					ec2RoleOptions.Client = imds.New(imds.Options{ClientEnableState: imds.ClientDisabled})
+				}
+			}
 			return nil
 		})
 		if err != nil {
-			return Token{}, fmt.Errorf("could not create session: %v", err)
+			return nil, nil, fmt.Errorf("could not create session: %v", err)
+		}
+		if usesIMDS {
+			return nil, nil, fmt.Errorf("could not create session: no credentials found and EC2 instance metadata is disabled")
 		}
 
-		if g.cache {
-			// figure out what profile we're using
-			var profile string
-			if v := os.Getenv("AWS_PROFILE"); len(v) > 0 {
-				profile = v
+		if sess.Region == "" && !options.DisableIMDS {
+			// nothing configured a region, fall back to the instance metadata
+			if imdsRegion, err := getIMDSRegion(ctx); err != nil {
+				g.log().Debug("unable to get region from instance metadata", Fields{"error": err})
 			} else {
-				profile = config.DefaultSharedConfigProfile
+				sess.Region = imdsRegion
 			}
+		}
+		g.log().Debug(fmt.Sprintf("using region %q to sign token", sess.Region), nil)
+
+		if g.cache && usesSSO {
+			// the cache doesn't track the SSO session the credentials came
+			// from, and the SDK already caches the SSO session itself
+			g.log().Debug("not caching credentials from AWS SSO", nil)
+		} else if g.cache {
 			// create a caching Provider wrapper around the Credentials
 			if cacheProvider, err := NewFileCacheProvider(options.ClusterID, profile, options.AssumeRoleARN, sess.Credentials); err == nil {
 				sess.Credentials = aws.NewCredentialsCache(&cacheProvider)
 			} else {
-				logrus.WithError(err).Errorf("unable to use cache")
+				g.log().Error("unable to use cache", Fields{"error": err})
 			}
 		}
 
 		options.Session = sess
 	}
 
+	var stsOptions []func(*sts.Options)
+	if suffix := options.UserAgentSuffix; suffix != "" {
+		stsOptions = append(stsOptions, func(options *sts.Options) {
+			options.APIOptions = append(options.APIOptions, addUserAgentSuffix(suffix))
+		})
+	}
+	if retryer := stsRetryer(options); retryer != nil {
+		stsOptions = append(stsOptions, func(options *sts.Options) {
+			options.Retryer = retryer
+		})
+	}
+	if endpointMode == STSLegacyEndpoint && stsLegacyGlobalRegions[options.Session.Region] {
+		stsOptions = append(stsOptions, func(options *sts.Options) {
+			options.Region = stsGlobalRegion
+		})
+	}
+
 	// use an STS client based on the direct credentials
-	stsClient := sts.NewFromConfig(options.Session)
+	stsClient := sts.NewFromConfig(options.Session, stsOptions...)
 
 	// if a roleARN was specified, replace the STS client with one that uses
 	// temporary credentials from that role.
 	if options.AssumeRoleARN != "" {
-		var sessionName string
-		if g.forwardSessionName {
-			// If the current session is already a federated identity, carry through
-			// this session name onto the new session to provide better debugging
-			// capabilities
-			resp, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
-			if err != nil {
-				return Token{}, err
-			}
-
-			userIDParts := strings.Split(*resp.UserId, ":")
-			if len(userIDParts) == 2 {
-				sessionName = userIDParts[1]
-			}
-		} else if options.SessionName != "" {
-			sessionName = options.SessionName
+		creds, err := g.assumeRoleProvider(ctx, stsClient, options)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		// create STS-based credentials that will assume the given role
-		creds := stscreds.NewAssumeRoleProvider(stsClient, options.AssumeRoleARN, func(assumeRoleOptions *stscreds.AssumeRoleOptions) {
-			if options.AssumeRoleExternalID != "" {
-				assumeRoleOptions.ExternalID = aws.String(options.AssumeRoleExternalID)
-			}
-			if sessionName != "" {
-				assumeRoleOptions.RoleSessionName = sessionName
-			}
-		})
-
 		// create an STS API interface that uses the assumed role's temporary credentials
-		stsClient = sts.NewFromConfig(options.Session, func(options *sts.Options) {
+		stsClient = sts.NewFromConfig(options.Session, append(stsOptions, func(options *sts.Options) {
 			options.Credentials = creds
+		})...)
+	}
+
+	if reuseClient {
+		g.clients.put(clientKey, cachedSTSClient{client: stsClient, session: options.Session})
+	}
+	return stsClient, nil, nil
+}
+
+// wrapSTSClient uses the pre-built options.STSClient to presign the token. It
+// can't be copied with different options, so the role in AssumeRoleARN and
+// UserAgentSuffix are returned as options to apply when presigning.
+func (g generator) wrapSTSClient(ctx context.Context, options *GetTokenOptions) (*sts.Client, []func(*sts.Options), error) {
+	var ignored []string
+	if options.Region != "" {
+		ignored = append(ignored, "Region")
+	}
+	if options.Profile != "" {
+		ignored = append(ignored, "Profile")
+	}
+	if options.Session.Credentials != nil || options.Session.Region != "" || options.Session.EndpointResolver != nil {
+		ignored = append(ignored, "Session")
+	}
+	if options.STSEndpointResolutionMode != "" {
+		ignored = append(ignored, "STSEndpointResolutionMode")
+	}
+	if options.MaxRetries != 0 {
+		ignored = append(ignored, "MaxRetries")
+	}
+	if options.Retryer != nil {
+		ignored = append(ignored, "Retryer")
+	}
+	if len(ignored) > 0 {
+		g.log().Warn(fmt.Sprintf("ignoring %s since an STS client was supplied", strings.Join(ignored, ", ")), nil)
+	}
+
+	var clientOptions []func(*sts.Options)
+	if suffix := options.UserAgentSuffix; suffix != "" {
+		clientOptions = append(clientOptions, func(options *sts.Options) {
+			options.APIOptions = append(options.APIOptions, addUserAgentSuffix(suffix))
 		})
 	}
+	if options.AssumeRoleARN != "" {
+		creds, err := g.assumeRoleProvider(ctx, options.STSClient, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		clientOptions = append(clientOptions, func(options *sts.Options) {
+			options.Credentials = creds
+		})
+	}
+	return options.STSClient, clientOptions, nil
+}
+
+// stsRetryer returns the retryer for calls to STS requested in options, or nil
+// to use the SDK's default.
+func stsRetryer(options *GetTokenOptions) aws.Retryer {
+	if options.Retryer != nil {
+		return options.Retryer
+	}
+	if options.MaxRetries > 0 {
+		return retry.AddWithMaxAttempts(retry.NewStandard(), options.MaxRetries+1)
+	}
+	return nil
+}
+
+// assumeRoleProvider returns STS-based credentials that assume the role in
+// options.AssumeRoleARN using stsClient.
+func (g generator) assumeRoleProvider(ctx context.Context, stsClient *sts.Client, options *GetTokenOptions) (aws.CredentialsProvider, error) {
+	var sessionName string
+	if g.forwardSessionName {
+		// If the current session is already a federated identity, carry through
+		// this session name onto the new session to provide better debugging
+		// capabilities
+		resp, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return nil, err
+		}
+
+		userIDParts := strings.Split(*resp.UserId, ":")
+		if len(userIDParts) == 2 {
+			sessionName = userIDParts[1]
+		}
+	} else if options.SessionName != "" {
+		sessionName = options.SessionName
+	}
+
+	// cache the role's credentials until they expire, as the client may be reused
+	return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, options.AssumeRoleARN, func(assumeRoleOptions *stscreds.AssumeRoleOptions) {
+		if options.AssumeRoleExternalID != "" {
+			assumeRoleOptions.ExternalID = aws.String(options.AssumeRoleExternalID)
+		}
+		if sessionName != "" {
+			assumeRoleOptions.RoleSessionName = sessionName
+		}
+	})), nil
+}
+
+// getIMDSRegion looks up the region of the EC2 instance we are running on.
+var getIMDSRegion = func(ctx context.Context) (string, error) {
+	output, err := imds.New(imds.Options{}).GetRegion(ctx, &imds.GetRegionInput{})
+	if err != nil {
+		return "", err
+	}
+	return output.Region, nil
+}
+
+// resolveRegion figures out what region to sign the token for. The explicitly
+// requested region wins over AWS_REGION, which wins over AWS_DEFAULT_REGION.
+// If none are set, "" is returned and the region is left to the shared config
+// profile and then the EC2 instance metadata.
+func resolveRegion(region string) string {
+	if region != "" {
+		return region
+	}
+	for _, key := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if v := e.Getenv(key); len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
 
-	return g.GetWithSTS(ctx, options.ClusterID, stsClient)
+// resolveProfile figures out what profile we're using. An explicitly
+// requested profile wins over AWS_PROFILE, which wins over the SDK default
+// profile.
+func resolveProfile(profile string) string {
+	if profile != "" {
+		return profile
+	}
+	if v := e.Getenv("AWS_PROFILE"); len(v) > 0 {
+		return v
+	}
+	return config.DefaultSharedConfigProfile
+}
+
+// addUserAgentSuffix returns a middleware adding suffix, of the form name or
+// name/version, to the User-Agent.
+func addUserAgentSuffix(suffix string) func(*smithymiddleware.Stack) error {
+	if i := strings.Index(suffix, "/"); i >= 0 {
+		return sdkMiddleware.AddUserAgentKeyValue(suffix[:i], suffix[i+1:])
+	}
+	return sdkMiddleware.AddUserAgentKey(suffix)
+}
+
+// resolveSTSEndpointResolutionMode figures out which STS endpoint to presign the
+// token for. The explicitly requested mode wins over AWS_STS_REGIONAL_ENDPOINTS,
+// and tokens are presigned for regional endpoints if neither is set.
+func resolveSTSEndpointResolutionMode(mode STSEndpointResolutionMode) STSEndpointResolutionMode {
+	if mode != "" {
+		return mode
+	}
+	if v := e.Getenv(stsRegionalEndpointsEnv); len(v) > 0 {
+		return STSEndpointResolutionMode(strings.ToLower(v))
+	}
+	return STSRegionalEndpoint
 }
 
 // GetWithSTS returns a token valid for clusterID using the given STS client.
 func (g generator) GetWithSTS(ctx context.Context, clusterID string, client *sts.Client) (Token, error) {
+	return g.getWithSTS(ctx, clusterID, client, nil)
+}
+
+// getWithSTS behaves like GetWithSTS, applying clientOptions to the client
+// when presigning.
+func (g generator) getWithSTS(ctx context.Context, clusterID string, client *sts.Client, clientOptions []func(*sts.Options)) (Token, error) {
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+
+	expiration := g.tokenExpiration()
 	// generate an sts:GetCallerIdentity request and add our custom cluster ID header
 	presigner := sts.NewPresignClient(client)
 	presignedURLRequest, err := presigner.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}, func(presignOptions *sts.PresignOptions) {
+		presignOptions.ClientOptions = append(presignOptions.ClientOptions, clientOptions...)
 		presignOptions.ClientOptions = append(presignOptions.ClientOptions, func(stsOptions *sts.Options) {
 			// Add clusterId Header
-			stsOptions.APIOptions = append(stsOptions.APIOptions, smithyhttp.SetHeaderValue(clusterIDHeader, clusterID))
-			// Add back useless X-Amz-Expires query param
-			stsOptions.APIOptions = append(stsOptions.APIOptions, smithyhttp.SetHeaderValue("X-Amz-Expires", "60"))
+			stsOptions.APIOptions = append(stsOptions.APIOptions, smithyhttp.SetHeaderValue(g.clusterIDHeader(), clusterID))
+			// Add back X-Amz-Expires query param, which STS ignores, matching the token expiration
+			stsOptions.APIOptions = append(stsOptions.APIOptions, smithyhttp.SetHeaderValue("X-Amz-Expires", strconv.Itoa(int(expiration/time.Second))))
 			// Remove not previously whitelisted X-Amz-User-Agent
 			stsOptions.APIOptions = append(stsOptions.APIOptions, func(stack *smithymiddleware.Stack) error {
 				_, err := stack.Build.Remove("UserAgent")
@@ -331,23 +913,93 @@ func (g generator) GetWithSTS(ctx context.Context, clusterID string, client *sts
 			})
 		})
 	})
+	if err != nil {
+		return Token{}, timeoutError(ctx, err)
+	}
+
+	tokenExpiration := time.Now().Local().Add(expiration)
+	if g.version == TokenV2 {
+		return g.v2Token(presignedURLRequest.URL, clusterID, tokenExpiration)
+	}
+	// the presigned URL carries a signature, so encode it in constant-time
+	return Token{g.tokenPrefix() + encodeBase64([]byte(presignedURLRequest.URL)), tokenExpiration}, nil
+}
+
+// v2Token wraps presignedURL in a v2Envelope with the region it was signed
+// for and clusterID.
+func (g generator) v2Token(presignedURL, clusterID string, expiration time.Time) (Token, error) {
+	parsedURL, err := url.Parse(presignedURL)
+	if err != nil {
+		return Token{}, err
+	}
+	region, err := credentialRegion(parsedURL.Query().Get("X-Amz-Credential"))
 	if err != nil {
 		return Token{}, err
 	}
+	envelope, err := json.Marshal(v2Envelope{
+		URL:       presignedURL,
+		Region:    region,
+		ClusterID: clusterID,
+	})
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{v2Prefix + encodeBase64(envelope), expiration}, nil
+}
+
+// credentialRegion returns the region of an X-Amz-Credential, which is of the
+// form <AccessKeyID>/<date>/<region>/sts/aws4_request.
+func credentialRegion(credential string) (string, error) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("unexpected X-Amz-Credential in pre-signed URL")
+	}
+	return parts[2], nil
+}
 
-	// Set token expiration to 1 minute before the presigned URL expires for some cushion
-	tokenExpiration := time.Now().Local().Add(presignedURLExpiration - 1*time.Minute)
-	// TODO: this may need to be a constant-time base64 encoding
-	return Token{v1Prefix + base64.RawURLEncoding.EncodeToString([]byte(presignedURLRequest.URL)), tokenExpiration}, nil
+// tokenMetadata recovers the signing access key and region from the
+// X-Amz-Credential parameter of the presigned URL encoded in the token.
+func tokenMetadata(tok Token, prefix string) (TokenMetadata, error) {
+	if strings.HasPrefix(tok.Token, v2Prefix) {
+		prefix = v2Prefix
+	}
+	tokenBytes, err := decodeBase64(strings.TrimPrefix(tok.Token, prefix))
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+	if prefix == v2Prefix {
+		var envelope v2Envelope
+		if err := json.Unmarshal(tokenBytes, &envelope); err != nil {
+			return TokenMetadata{}, err
+		}
+		tokenBytes = []byte(envelope.URL)
+	}
+	parsedURL, err := url.Parse(string(tokenBytes))
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+	// X-Amz-Credential is of the form <AccessKeyID>/<date>/<region>/sts/aws4_request
+	credential := strings.Split(parsedURL.Query().Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 {
+		return TokenMetadata{}, fmt.Errorf("unexpected X-Amz-Credential in pre-signed URL")
+	}
+	return TokenMetadata{
+		AccessKeyID: credential[0],
+		RegionUsed:  credential[2],
+	}, nil
 }
 
 // FormatJSON formats the json to support ExecCredential authentication
 func (g generator) FormatJSON(token Token) string {
+	return formatExecCredential(token)
+}
+
+func formatExecCredential(token Token) string {
 	expirationTimestamp := metav1.NewTime(token.Expiration)
 	execInput := &clientauthv1alpha1.ExecCredential{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "client.authentication.k8s.io/v1alpha1",
-			Kind:       "ExecCredential",
+			APIVersion: execCredentialAPIVersion,
+			Kind:       execCredentialKind,
 		},
 		Status: &clientauthv1alpha1.ExecCredentialStatus{
 			ExpirationTimestamp: &expirationTimestamp,
@@ -358,36 +1010,210 @@ func (g generator) FormatJSON(token Token) string {
 	return string(enc)
 }
 
+// tempFileCount makes the names of temporary files written by this process
+// unique.
+var tempFileCount uint64
+
+// WriteExecCredential writes token to path, formatted like FormatJSON, for
+// setups that capture the exec credential in a file. The file is replaced
+// atomically and is only readable by the user, so processes reading it
+// concurrently never see a partial write. apiVersion is the ExecCredential
+// apiVersion to write; if empty, the one FormatJSON emits is used.
+func WriteExecCredential(path string, token Token, apiVersion string) error {
+	if apiVersion != "" && apiVersion != execCredentialAPIVersion {
+		return fmt.Errorf("unsupported ExecCredential apiVersion %q, only %q is supported", apiVersion, execCredentialAPIVersion)
+	}
+	tempPath := fmt.Sprintf("%s.%d-%d.tmp", path, os.Getpid(), atomic.AddUint64(&tempFileCount, 1))
+	if err := f.WriteFile(tempPath, []byte(formatExecCredential(token)), 0o600); err != nil {
+		f.Remove(tempPath)
+		return fmt.Errorf("unable to write exec credential to %s: %v", tempPath, err)
+	}
+	if err := f.Rename(tempPath, path); err != nil {
+		f.Remove(tempPath)
+		return fmt.Errorf("unable to replace exec credential %s: %v", path, err)
+	}
+	return nil
+}
+
+// ValidateExecConfig checks that a token formatted with FormatJSON will be
+// accepted by the client that invoked us as an exec credential plugin.
+// execInfo is the value of the KUBERNETES_EXEC_INFO environment variable,
+// which may be empty for clients that do not set it.
+func ValidateExecConfig(clusterID string, execInfo string) error {
+	if clusterID == "" {
+		return fmt.Errorf("cluster ID not specified: add \"-i\", \"<cluster-id>\" to the exec args in your kubeconfig")
+	}
+	if execInfo == "" {
+		return nil
+	}
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal([]byte(execInfo), &typeMeta); err != nil {
+		return fmt.Errorf("could not parse %s: %v", execInfoEnv, err)
+	}
+	if typeMeta.Kind != execCredentialKind {
+		return fmt.Errorf("%s has kind %q, expected %q", execInfoEnv, typeMeta.Kind, execCredentialKind)
+	}
+	if typeMeta.APIVersion != execCredentialAPIVersion {
+		return fmt.Errorf("exec plugin is configured with apiVersion %q but only %q is supported: set apiVersion: %s in the exec section of your kubeconfig",
+			typeMeta.APIVersion, execCredentialAPIVersion, execCredentialAPIVersion)
+	}
+	return nil
+}
+
 // Verifier validates tokens by calling STS and returning the associated identity.
 type Verifier interface {
 	Verify(token string) (*Identity, error)
+	// VerifyLocal runs every check Verify does before calling STS and returns
+	// what the token's pre-signed URL claims, without touching the network.
+	VerifyLocal(token string) (*PresignedRequestInfo, error)
+	// Ping checks that STS can be reached, without authenticating to it.
+	Ping(ctx context.Context) error
+	// SetClusterID rebinds the verifier to clusterID. Verifications already
+	// in progress use either the old or the new cluster ID throughout.
+	SetClusterID(clusterID string)
+}
+
+// PresignedRequestInfo describes the pre-signed STS request encoded in a token,
+// as claimed by the token itself. Nothing in it has been authenticated by STS.
+type PresignedRequestInfo struct {
+	// Host is the STS hostname the request is addressed to.
+	Host string
+	// Region is the region from the request's X-Amz-Credential scope, or ""
+	// if the credential doesn't carry one.
+	Region string
+	// CredentialScopeDate is the date from the request's X-Amz-Credential
+	// scope, or the zero time if the credential doesn't carry one.
+	CredentialScopeDate time.Time
+	// Date is the time the request was signed, from X-Amz-Date.
+	Date time.Time
+	// AccessKeyID is the AWS Access Key ID the request claims to be signed with.
+	AccessKeyID string
+	// ClusterID is the cluster ID a v2 token claims to be for, or "" for a v1
+	// token. STS checks the claim when the token is verified.
+	ClusterID string
 }
 
 type tokenVerifier struct {
-	client            *http.Client
-	clusterID         string
-	validSTShostnames map[string]bool
+	client                  *http.Client
+	clusterID               *atomic.Value
+	additionalClusterIDs    []string
+	additionalSignedHeaders map[string]bool
+	validSTShostnames       map[string]bool
+	metrics                 MetricsRecorder
+	pingURL                 string
+	prefix                  string
+	header                  string
+	regionClients           map[string]*http.Client
+	partitionID             string
+	allowUnlistedRegions    bool
+	requireTemporaryCreds   bool
+	maxTokenLen             int
+	limiter                 *stsLimiter
+	queueTimeout            time.Duration
 }
 
-func stsHostsForPartition(partitionID string) map[string]bool {
+// newClusterIDValue returns an atomic.Value holding clusterID, so that the
+// copies of a tokenVerifier share the cluster ID it is bound to.
+func newClusterIDValue(clusterID string) *atomic.Value {
+	value := &atomic.Value{}
+	value.Store(clusterID)
+	return value
+}
+
+// boundClusterID returns the cluster ID the verifier is bound to.
+func (v tokenVerifier) boundClusterID() string {
+	if v.clusterID == nil {
+		return ""
+	}
+	return v.clusterID.Load().(string)
+}
+
+// SetClusterID rebinds the verifier, and every copy of it, to clusterID.
+func (v tokenVerifier) SetClusterID(clusterID string) {
+	v.clusterID.Store(clusterID)
+}
+
+// metricsRecorder returns the verifier's MetricsRecorder, which does nothing
+// unless one was passed in VerifierOptions.
+func (v tokenVerifier) metricsRecorder() MetricsRecorder {
+	if v.metrics == nil {
+		return noopMetricsRecorder{}
+	}
+	return v.metrics
+}
+
+// tokenPrefix returns the prefix tokens must have.
+func (v tokenVerifier) tokenPrefix() string {
+	if v.prefix == "" {
+		return v1Prefix
+	}
+	return v.prefix
+}
+
+// maxTokenLength returns the length in bytes tokens must not exceed.
+func (v tokenVerifier) maxTokenLength() int {
+	if v.maxTokenLen == 0 {
+		return maxTokenLenBytes
+	}
+	return v.maxTokenLen
+}
+
+// minTokenPayloadLen is the length of the shortest pre-signed URL encoded in
+// unpadded base64, below which a token can't be valid.
+var minTokenPayloadLen = len(encodeBase64([]byte(minPresignedURL)))
+
+// clusterIDHeader returns the header the cluster ID must be signed in.
+func (v tokenVerifier) clusterIDHeader() string {
+	if v.header == "" {
+		return clusterIDHeader
+	}
+	return v.header
+}
+
+// stsPingURL returns the URL of an unauthenticated GetCallerIdentity call to
+// the STS endpoint of region, or "" if it can't be resolved.
+func stsPingURL(region string, logger Logger) string {
+	endpoint, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(region, sts.EndpointResolverOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error resolving endpoint for sts in region %s", region), Fields{"error": err})
+		return ""
+	}
+	return endpoint.URL + "/?Action=GetCallerIdentity&Version=2011-06-15"
+}
+
+// stsHostForRegion returns the hostname of the STS endpoint of region.
+func stsHostForRegion(region string) (string, error) {
+	endpoint, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(region, sts.EndpointResolverOptions{})
+	if err != nil {
+		return "", err
+	}
+	parsedURL, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return "", err
+	}
+	return parsedURL.Hostname(), nil
+}
+
+func stsHostsForPartition(partitionID string, logger Logger) map[string]bool {
 	validSTShostnames := map[string]bool{}
 
 	resolver := sts.NewDefaultEndpointResolver()
 	regions := partitions.GetRegions(partitionID)
 	if len(regions) == 0 {
-		logrus.Errorf("STS service not found in partition %s", partitionID)
+		logger.Error(fmt.Sprintf("STS service not found in partition %s", partitionID), nil)
 		return validSTShostnames
 	}
 	for _, region := range regions {
 		endpoint, err := resolver.ResolveEndpoint(region, sts.EndpointResolverOptions{})
 		if err != nil {
-			logrus.WithError(err).Errorf("Error resolving endpoint for sts in partition %s", partitionID)
+			logger.Error(fmt.Sprintf("Error resolving endpoint for sts in partition %s", partitionID), Fields{"error": err})
 			continue
 		}
 
 		parsedURL, err := url.Parse(endpoint.URL)
 		if err != nil {
-			logrus.WithError(err).Errorf("Error parsing STS URL %s", endpoint.URL)
+			logger.Error(fmt.Sprintf("Error parsing STS URL %s", endpoint.URL), Fields{"error": err})
 			continue
 		}
 		validSTShostnames[parsedURL.Hostname()] = true
@@ -396,23 +1222,253 @@ func stsHostsForPartition(partitionID string) map[string]bool {
 	return validSTShostnames
 }
 
+// VerifierOptions is passed to NewVerifierWithOptions to provide an extensible
+// way of configuring a Verifier.
+type VerifierOptions struct {
+	// AllowedHosts are STS hostnames accepted in addition to the ones
+	// resolved by the SDK for the verifier's partition.
+	AllowedHosts AllowedHosts
+	// AdditionalClusterIDs are cluster IDs tokens are accepted for besides
+	// the verifier's own, e.g. while migrating clients between clusters.
+	AdditionalClusterIDs []string
+	// AdditionalSignedHeaders are headers a pre-signed URL may sign besides
+	// host and the cluster ID header.
+	AdditionalSignedHeaders []string
+	// Metrics records the outcome of each verification and the latency of
+	// calls to STS.
+	Metrics MetricsRecorder
+	// PingRegion is the region whose STS endpoint Ping checks. If empty,
+	// Region or else the first region of the verifier's partition is used.
+	PingRegion string
+	// TokenPrefix replaces the "k8s-aws-v1." prefix tokens must have.
+	TokenPrefix string
+	// ClusterIDHeader replaces the "x-k8s-aws-id" header the cluster ID must
+	// be signed in.
+	ClusterIDHeader string
+	// ConnectionPool tunes the connections kept open to STS.
+	ConnectionPool ConnectionPoolOptions
+	// MaxRedirects is how many redirects from STS, e.g. from a private STS
+	// proxy, are followed. Only redirects over https to accepted STS hostnames
+	// are followed. Zero means redirects are never followed.
+	MaxRedirects int
+	// AllowUnlistedRegions accepts the regional STS hostnames of regions
+	// missing from the partition's region list, such as newly enabled opt-in
+	// regions, as long as the SDK resolves the hostname for a region of the
+	// verifier's partition.
+	AllowUnlistedRegions bool
+	// Region, if set, restricts the accepted STS hostnames to the endpoint of
+	// this region of the verifier's partition, typically the cluster's own, so
+	// tokens signed for STS in any other region are rejected. AllowedHosts are
+	// still accepted. If empty, every region of the partition is accepted.
+	Region string
+	// RequireTemporaryCredentials rejects tokens signed with long-term
+	// credentials, such as IAM user access keys, by requiring the pre-signed
+	// URL to carry the X-Amz-Security-Token of temporary credentials.
+	RequireTemporaryCredentials bool
+	// ProxyURL is the URL of a proxy to send calls to STS through, instead of
+	// the one set by the HTTP_PROXY and HTTPS_PROXY environment variables.
+	// Hosts excluded by NO_PROXY, such as STS VPC endpoints, are still called
+	// directly.
+	ProxyURL string
+	// MaxConcurrentSTSCalls bounds the number of calls to STS in flight
+	// across all verifications, to keep a spike of token reviews from
+	// getting the account throttled by STS. Zero means unbounded.
+	MaxConcurrentSTSCalls int
+	// MaxQueuedSTSCalls is how many calls over MaxConcurrentSTSCalls wait for
+	// another call to finish. Verify returns an OverloadedError for calls
+	// over both limits.
+	MaxQueuedSTSCalls int
+	// STSQueueTimeout is how long a queued call waits before Verify returns
+	// an OverloadedError. Zero means queued calls wait indefinitely.
+	STSQueueTimeout time.Duration
+	// MaxTokenLength is the length in bytes tokens must not exceed, for
+	// environments with unusually long credential scopes or session tokens.
+	// If zero, tokens are limited to 4KB.
+	MaxTokenLength int
+	// Logger receives the verifier's log messages. If nil, they are logged
+	// with logrus.
+	Logger Logger
+}
+
 // NewVerifier creates a Verifier that is bound to the clusterID and uses the default http client.
 func NewVerifier(clusterID string, partitionID string) Verifier {
+	return newTokenVerifier(clusterID, partitionID, logrusLogger{})
+}
+
+// NewVerifierForRegion creates a Verifier like NewVerifier for the partition
+// of region, that only accepts tokens addressed to the STS endpoint of region.
+func NewVerifierForRegion(clusterID, region string) (Verifier, error) {
+	partitionID, ok := partitions.PartitionForRegion(region)
+	if !ok {
+		return nil, fmt.Errorf("region %q is not in any known partition", region)
+	}
+	v := newTokenVerifier(clusterID, partitionID, logrusLogger{})
+	if err := v.restrictToRegion(region, logrusLogger{}); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// restrictToRegion makes the verifier only accept tokens addressed to the STS
+// endpoint of region, and ping that endpoint.
+func (v *tokenVerifier) restrictToRegion(region string, logger Logger) error {
+	host, err := stsHostForRegion(region)
+	if err != nil {
+		return fmt.Errorf("error resolving endpoint for sts in region %s: %v", region, err)
+	}
+	v.validSTShostnames = map[string]bool{host: true}
+	v.pingURL = stsPingURL(region, logger)
+	return nil
+}
+
+func newTokenVerifier(clusterID string, partitionID string, logger Logger) tokenVerifier {
+	var pingURL string
+	if regions := partitions.GetRegions(partitionID); len(regions) > 0 {
+		pingURL = stsPingURL(regions[0], logger)
+	}
 	return tokenVerifier{
 		client: &http.Client{
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+			Transport:     newTransport(),
+			CheckRedirect: doNotFollowRedirects,
 		},
-		clusterID:         clusterID,
-		validSTShostnames: stsHostsForPartition(partitionID),
+		clusterID:         newClusterIDValue(clusterID),
+		partitionID:       partitionID,
+		validSTShostnames: stsHostsForPartition(partitionID, logger),
+		pingURL:           pingURL,
 	}
 }
 
+// NewVerifierWithOptions creates a Verifier like NewVerifier, configured by options.
+func NewVerifierWithOptions(clusterID string, partitionID string, options VerifierOptions) (Verifier, error) {
+	if err := options.AllowedHosts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.ConnectionPool.validate(); err != nil {
+		return nil, err
+	}
+	if options.MaxRedirects < 0 {
+		return nil, fmt.Errorf("MaxRedirects must not be negative, got %d", options.MaxRedirects)
+	}
+	if options.MaxTokenLength < 0 {
+		return nil, fmt.Errorf("MaxTokenLength must not be negative, got %d", options.MaxTokenLength)
+	}
+	if options.MaxConcurrentSTSCalls < 0 || options.MaxQueuedSTSCalls < 0 || options.STSQueueTimeout < 0 {
+		return nil, fmt.Errorf("MaxConcurrentSTSCalls, MaxQueuedSTSCalls and STSQueueTimeout must not be negative")
+	}
+	if options.MaxConcurrentSTSCalls == 0 && (options.MaxQueuedSTSCalls > 0 || options.STSQueueTimeout > 0) {
+		return nil, fmt.Errorf("MaxQueuedSTSCalls and STSQueueTimeout require MaxConcurrentSTSCalls")
+	}
+	var proxyURL *url.URL
+	if options.ProxyURL != "" {
+		var err error
+		if proxyURL, err = parseProxyURL(options.ProxyURL); err != nil {
+			return nil, err
+		}
+	}
+	if options.Region != "" {
+		if regionPartitionID, _ := partitions.PartitionForRegion(options.Region); regionPartitionID != partitionID {
+			return nil, fmt.Errorf("region %q is not in partition %s", options.Region, partitionID)
+		}
+		if options.AllowUnlistedRegions {
+			return nil, fmt.Errorf("AllowUnlistedRegions can't be combined with Region")
+		}
+	}
+	logger := loggerOrDefault(options.Logger)
+	v := newTokenVerifier(clusterID, partitionID, logger)
+	if options.Region != "" {
+		if err := v.restrictToRegion(options.Region, logger); err != nil {
+			return nil, err
+		}
+	}
+	v.client = options.ConnectionPool.newClient()
+	if len(options.ConnectionPool.DedicatedRegions) > 0 {
+		v.regionClients = map[string]*http.Client{}
+		for _, region := range options.ConnectionPool.DedicatedRegions {
+			v.regionClients[region] = options.ConnectionPool.newClient()
+		}
+	}
+	if proxyURL != nil {
+		proxy := proxyFunc(proxyURL, noProxyFromEnvironment())
+		v.client.Transport.(*http.Transport).Proxy = proxy
+		for _, client := range v.regionClients {
+			client.Transport.(*http.Transport).Proxy = proxy
+		}
+	}
+	if options.MaxRedirects > 0 {
+		checkRedirect := v.followRedirects(options.MaxRedirects)
+		v.client.CheckRedirect = checkRedirect
+		for _, client := range v.regionClients {
+			client.CheckRedirect = checkRedirect
+		}
+	}
+	options.AllowedHosts.merge(partitionID, v.validSTShostnames)
+	v.additionalClusterIDs = options.AdditionalClusterIDs
+	v.metrics = options.Metrics
+	if options.PingRegion != "" {
+		v.pingURL = stsPingURL(options.PingRegion, logger)
+	}
+	v.prefix = options.TokenPrefix
+	v.header = strings.ToLower(options.ClusterIDHeader)
+	v.allowUnlistedRegions = options.AllowUnlistedRegions
+	v.requireTemporaryCreds = options.RequireTemporaryCredentials
+	v.maxTokenLen = options.MaxTokenLength
+	if options.MaxConcurrentSTSCalls > 0 {
+		v.limiter = newSTSLimiter(options.MaxConcurrentSTSCalls, options.MaxQueuedSTSCalls)
+		v.queueTimeout = options.STSQueueTimeout
+	}
+	if len(options.AdditionalSignedHeaders) > 0 {
+		v.additionalSignedHeaders = map[string]bool{}
+		for _, hdr := range options.AdditionalSignedHeaders {
+			v.additionalSignedHeaders[strings.ToLower(hdr)] = true
+		}
+	}
+	return v, nil
+}
+
+// followRedirects returns a CheckRedirect function following up to max
+// redirects, as long as they stay on https and accepted STS hostnames. The
+// response redirecting once more than max is returned as is.
+func (v tokenVerifier) followRedirects(max int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > max {
+			return http.ErrUseLastResponse
+		}
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unexpected scheme %q", req.URL.Scheme)
+		}
+		if err := v.verifyHost(req.URL.Host); err != nil {
+			return fmt.Errorf("redirect to unexpected hostname %q", req.URL.Host)
+		}
+		return nil
+	}
+}
+
+// regionName matches the names of AWS regions, e.g. "ap-southeast-3".
+var regionName = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// isUnlistedRegionHost reports whether host is the regional STS hostname the
+// SDK resolves for a region of the verifier's partition, even though the
+// region isn't listed in the partition.
+func (v tokenVerifier) isUnlistedRegionHost(host string) bool {
+	m := regionalSTSHost.FindStringSubmatch(host)
+	if m == nil || !regionName.MatchString(m[1]) {
+		return false
+	}
+	endpoint, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(m[1], sts.EndpointResolverOptions{})
+	if err != nil || endpoint.PartitionID != v.partitionID {
+		return false
+	}
+	parsedURL, err := url.Parse(endpoint.URL)
+	return err == nil && parsedURL.Host == host
+}
+
 // verify a sts host, doc: http://docs.amazonaws.cn/en_us/general/latest/gr/rande.html#sts_region
 func (v tokenVerifier) verifyHost(host string) error {
 	if _, ok := v.validSTShostnames[host]; !ok {
-		return FormatError{fmt.Sprintf("unexpected hostname %q in pre-signed URL", host)}
+		if v.allowUnlistedRegions && v.isUnlistedRegionHost(host) {
+			return nil
+		}
+		return FormatError{message: fmt.Sprintf("unexpected hostname %q in pre-signed URL", host)}
 	}
 	return nil
 }
@@ -421,108 +1477,205 @@ func (v tokenVerifier) verifyHost(host string) error {
 // Identity that contains information about the AWS principal that created the
 // token. On failure, returns nil and a non-nil error.
 func (v tokenVerifier) Verify(token string) (*Identity, error) {
-	if len(token) > maxTokenLenBytes {
-		return nil, FormatError{"token is too large"}
+	id, err := v.verify(token)
+	v.metricsRecorder().ObserveVerify(verifyResult(err))
+	return id, err
+}
+
+// VerifyLocal validates everything about a token that can be checked without
+// calling STS. A nil error does not mean the token is authentic: its signature
+// is only ever checked by STS during Verify.
+func (v tokenVerifier) VerifyLocal(token string) (*PresignedRequestInfo, error) {
+	_, info, err := v.parse(token)
+	return info, err
+}
+
+// parse decodes a token and validates its pre-signed URL up to, but not
+// including, the call to STS.
+func (v tokenVerifier) parse(token string) (*url.URL, *PresignedRequestInfo, error) {
+	if len(token) > v.maxTokenLength() {
+		return nil, nil, FormatError{message: "token is too large"}
 	}
 
-	if !strings.HasPrefix(token, v1Prefix) {
-		return nil, FormatError{fmt.Sprintf("token is missing expected %q prefix", v1Prefix)}
+	prefix := v.tokenPrefix()
+	if strings.HasPrefix(token, v2Prefix) {
+		prefix = v2Prefix
+	} else if !strings.HasPrefix(token, prefix) {
+		return nil, nil, FormatError{message: fmt.Sprintf("token is missing expected %q prefix", prefix)}
 	}
 
-	// TODO: this may need to be a constant-time base64 decoding
-	tokenBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, v1Prefix))
+	if len(token)-len(prefix) < minTokenPayloadLen {
+		return nil, nil, FormatError{message: "token is too short"}
+	}
+
+	// the token is untrusted input, so decode it in constant-time
+	tokenBytes, err := decodeBase64(strings.TrimPrefix(token, prefix))
 	if err != nil {
-		return nil, FormatError{err.Error()}
+		return nil, nil, FormatError{message: err.Error()}
+	}
+
+	var envelope *v2Envelope
+	if prefix == v2Prefix {
+		envelope = &v2Envelope{}
+		if err := json.Unmarshal(tokenBytes, envelope); err != nil {
+			return nil, nil, FormatError{message: fmt.Sprintf("malformed v2 token: %v", err)}
+		}
+		tokenBytes = []byte(envelope.URL)
 	}
 
 	parsedURL, err := url.Parse(string(tokenBytes))
 	if err != nil {
-		return nil, FormatError{err.Error()}
+		return nil, nil, FormatError{message: err.Error()}
 	}
 
 	if parsedURL.Scheme != "https" {
-		return nil, FormatError{fmt.Sprintf("unexpected scheme %q in pre-signed URL", parsedURL.Scheme)}
+		return nil, nil, FormatError{message: fmt.Sprintf("unexpected scheme %q in pre-signed URL", parsedURL.Scheme)}
 	}
 
 	if err = v.verifyHost(parsedURL.Host); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if parsedURL.Path != "/" {
-		return nil, FormatError{"unexpected path in pre-signed URL"}
+		return nil, nil, FormatError{message: "unexpected path in pre-signed URL"}
+	}
+
+	if parsedURL.User != nil || parsedURL.Fragment != "" || parsedURL.Opaque != "" {
+		return nil, nil, FormatError{message: "pre-signed URL is not a plain GET request URL"}
 	}
 
 	queryParamsLower := make(url.Values)
 	queryParams, err := url.ParseQuery(parsedURL.RawQuery)
 	if err != nil {
-		return nil, FormatError{"malformed query parameter"}
+		return nil, nil, FormatError{message: "malformed query parameter"}
 	}
 
 	for key, values := range queryParams {
 		if !parameterWhitelist[strings.ToLower(key)] {
-			return nil, FormatError{fmt.Sprintf("non-whitelisted query parameter %q", key)}
+			return nil, nil, FormatError{message: fmt.Sprintf("non-whitelisted query parameter %q", key)}
 		}
 		if len(values) != 1 {
-			return nil, FormatError{"query parameter with multiple values not supported"}
+			return nil, nil, FormatError{message: "query parameter with multiple values not supported"}
 		}
 		queryParamsLower.Set(strings.ToLower(key), values[0])
 	}
 
 	if queryParamsLower.Get("action") != "GetCallerIdentity" {
-		return nil, FormatError{"unexpected action parameter in pre-signed URL"}
+		return nil, nil, FormatError{message: "unexpected action parameter in pre-signed URL"}
 	}
 
-	if !hasSignedClusterIDHeader(&queryParamsLower) {
-		return nil, FormatError{fmt.Sprintf("client did not sign the %s header in the pre-signed URL", clusterIDHeader)}
+	if !hasSignedClusterIDHeader(&queryParamsLower, v.clusterIDHeader()) {
+		return nil, nil, FormatError{message: fmt.Sprintf("client did not sign the %s header in the pre-signed URL", v.clusterIDHeader())}
+	}
+
+	if err := v.verifySignedHeaders(&queryParamsLower); err != nil {
+		return nil, nil, err
+	}
+
+	if err := verifyGetRequest(&queryParamsLower); err != nil {
+		return nil, nil, err
 	}
 
 	// We validate x-amz-expires is between 0 and 15 minutes (900 seconds) although currently pre-signed STS URLs, and
 	// therefore tokens, expire exactly 15 minutes after the x-amz-date header, regardless of x-amz-expires.
 	expires, err := strconv.Atoi(queryParamsLower.Get("x-amz-expires"))
 	if err != nil || expires < 0 || expires > 900 {
-		return nil, FormatError{fmt.Sprintf("invalid X-Amz-Expires parameter in pre-signed URL: %d", expires)}
+		return nil, nil, FormatError{message: fmt.Sprintf("invalid X-Amz-Expires parameter in pre-signed URL: %d", expires)}
+	}
+
+	if v.requireTemporaryCreds && queryParamsLower.Get("x-amz-security-token") == "" {
+		return nil, nil, FormatError{message: "pre-signed URL was not signed with temporary credentials: X-Amz-Security-Token parameter must be present"}
 	}
 
 	date := queryParamsLower.Get("x-amz-date")
 	if date == "" {
-		return nil, FormatError{"X-Amz-Date parameter must be present in pre-signed URL"}
+		return nil, nil, FormatError{message: "X-Amz-Date parameter must be present in pre-signed URL"}
 	}
 
-	// Obtain AWS Access Key ID from supplied credentials
-	accessKeyID := strings.Split(queryParamsLower.Get("x-amz-credential"), "/")[0]
+	// X-Amz-Credential is of the form <AccessKeyID>/<date>/<region>/sts/aws4_request
+	credential := strings.Split(queryParamsLower.Get("x-amz-credential"), "/")
 
 	dateParam, err := time.Parse(dateHeaderFormat, date)
 	if err != nil {
-		return nil, FormatError{fmt.Sprintf("error parsing X-Amz-Date parameter %s into format %s: %s", date, dateHeaderFormat, err.Error())}
+		return nil, nil, FormatError{message: fmt.Sprintf("error parsing X-Amz-Date parameter %s into format %s: %s", date, dateHeaderFormat, err.Error())}
 	}
 
 	now := time.Now()
 	expiration := dateParam.Add(presignedURLExpiration)
 	if now.After(expiration) {
-		return nil, FormatError{fmt.Sprintf("X-Amz-Date parameter is expired (%.f minute expiration) %s", presignedURLExpiration.Minutes(), dateParam)}
+		return nil, nil, FormatError{expired: true, message: fmt.Sprintf("X-Amz-Date parameter is expired (%.f minute expiration) %s", presignedURLExpiration.Minutes(), dateParam)}
 	}
 
-	req, err := http.NewRequest("GET", parsedURL.String(), nil)
-	req.Header.Set(clusterIDHeader, v.clusterID)
-	req.Header.Set("accept", "application/json")
+	info := &PresignedRequestInfo{
+		Host:        parsedURL.Host,
+		Date:        dateParam,
+		AccessKeyID: credential[0],
+	}
+	if len(credential) == 5 {
+		info.Region = credential[2]
+		if scopeDate, err := time.Parse(credentialScopeDateFormat, credential[1]); err == nil {
+			info.CredentialScopeDate = scopeDate
+		}
+	}
+	if envelope != nil {
+		if err := v.verifyEnvelope(envelope, parsedURL.Hostname(), info.Region); err != nil {
+			return nil, nil, err
+		}
+		info.ClusterID = envelope.ClusterID
+	}
+	return parsedURL, info, nil
+}
 
-	response, err := v.client.Do(req)
-	if err != nil {
-		// special case to avoid printing the full URL if possible
-		if urlErr, ok := err.(*url.Error); ok {
-			return nil, NewSTSError(fmt.Sprintf("error during GET: %v", urlErr.Err))
+// regionalSTSHost matches the regional STS endpoints, capturing the region.
+var regionalSTSHost = regexp.MustCompile(`^sts(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// verifyEnvelope cross-checks the claims of a v2 token against its pre-signed
+// URL, which was signed for credentialRegion and addressed to host.
+func (v tokenVerifier) verifyEnvelope(envelope *v2Envelope, host, credentialRegion string) error {
+	if envelope.Region == "" {
+		return FormatError{message: "v2 token is missing region"}
+	}
+	if envelope.Region != credentialRegion {
+		return FormatError{message: fmt.Sprintf("v2 token region %q does not match the pre-signed URL's region %q", envelope.Region, credentialRegion)}
+	}
+	if m := regionalSTSHost.FindStringSubmatch(host); m != nil && m[1] != envelope.Region {
+		return FormatError{message: fmt.Sprintf("v2 token region %q does not match hostname %q", envelope.Region, host)}
+	}
+	for _, clusterID := range v.clusterIDs() {
+		if envelope.ClusterID == clusterID {
+			return nil
 		}
-		return nil, NewSTSError(fmt.Sprintf("error during GET: %v", err))
 	}
-	defer response.Body.Close()
+	return FormatError{message: fmt.Sprintf("v2 token is for unexpected cluster ID %q", envelope.ClusterID)}
+}
 
-	responseBody, err := ioutil.ReadAll(response.Body)
+func (v tokenVerifier) verify(token string) (*Identity, error) {
+	parsedURL, info, err := v.parse(token)
 	if err != nil {
-		return nil, NewSTSError(fmt.Sprintf("error reading HTTP result: %v", err))
+		return nil, err
 	}
 
-	if response.StatusCode != 200 {
-		return nil, NewSTSError(fmt.Sprintf("error from AWS (expected 200, got %d). Body: %s", response.StatusCode, string(responseBody[:])))
+	// The cluster ID the token was signed for isn't part of a v1 token's
+	// pre-signed URL, so try each acceptable cluster ID until STS accepts the
+	// signature. A v2 token names it, so only that one is tried.
+	var responseBody []byte
+	clusterIDs := v.clusterIDs()
+	if info.ClusterID != "" {
+		clusterIDs = []string{info.ClusterID}
+	}
+	for i, clusterID := range clusterIDs {
+		statusCode, body, err := v.getCallerIdentity(parsedURL, info.Region, clusterID)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode == http.StatusOK {
+			responseBody = body
+			break
+		}
+		if statusCode == http.StatusForbidden && i < len(clusterIDs)-1 {
+			continue
+		}
+		return nil, NewSTSError(fmt.Sprintf("error from AWS (expected 200, got %d). Body: %s", statusCode, string(body[:])))
 	}
 
 	var callerIdentity getCallerIdentityWrapper
@@ -533,11 +1686,24 @@ func (v tokenVerifier) Verify(token string) (*Identity, error) {
 
 	// parse the response into an Identity
 	id := &Identity{
-		ARN:         callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Arn,
-		AccountID:   callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Account,
-		AccessKeyID: accessKeyID,
+		ARN:                 callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Arn,
+		AccountID:           callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.Account,
+		AccessKeyID:         info.AccessKeyID,
+		Region:              info.Region,
+		CredentialScopeDate: info.CredentialScopeDate,
+	}
+	if id.Region == "" {
+		if m := regionalSTSHost.FindStringSubmatch(parsedURL.Hostname()); m != nil {
+			id.Region = m[1]
+		}
+	}
+	if v.partitionID != "" {
+		// an identity from another partition can't have signed a token for
+		// this partition's STS endpoints
+		id.CanonicalARN, err = arn.CanonicalizeForPartition(id.ARN, v.partitionID)
+	} else {
+		id.CanonicalARN, err = arn.Canonicalize(id.ARN)
 	}
-	id.CanonicalARN, err = arn.Canonicalize(id.ARN)
 	if err != nil {
 		return nil, NewSTSError(err.Error())
 	}
@@ -555,14 +1721,128 @@ func (v tokenVerifier) Verify(token string) (*Identity, error) {
 			"malformed UserID %q",
 			callerIdentity.GetCallerIdentityResponse.GetCallerIdentityResult.UserID)}
 	}
+	id.PrincipalType = principalType(id.ARN, id.SessionName)
+	id.RoleName = roleName(id.CanonicalARN)
 
 	return id, nil
 }
 
-func hasSignedClusterIDHeader(paramsLower *url.Values) bool {
+// Ping checks that STS can be reached by making an unauthenticated
+// GetCallerIdentity call. STS is expected to reject it, so any response other
+// than a server error shows STS is reachable; only failing to get one is
+// returned as an STSError.
+func (v tokenVerifier) Ping(ctx context.Context) error {
+	if v.pingURL == "" {
+		return NewSTSError("no STS endpoint to ping")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", v.pingURL, nil)
+	if err != nil {
+		return NewSTSError(fmt.Sprintf("error creating request: %v", err))
+	}
+	response, err := v.client.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			return NewSTSError(fmt.Sprintf("STS is unreachable: %v", urlErr.Err))
+		}
+		return NewSTSError(fmt.Sprintf("STS is unreachable: %v", err))
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return NewSTSError(fmt.Sprintf("STS is unavailable (got %d)", response.StatusCode))
+	}
+	return nil
+}
+
+// clusterIDs returns the cluster IDs tokens are accepted for.
+func (v tokenVerifier) clusterIDs() []string {
+	return append([]string{v.boundClusterID()}, v.additionalClusterIDs...)
+}
+
+// getCallerIdentity calls STS in region with the pre-signed URL, sending
+// clusterID as the signed cluster ID header, and returns the status code and
+// body.
+func (v tokenVerifier) getCallerIdentity(parsedURL *url.URL, region, clusterID string) (int, []byte, error) {
+	req, err := http.NewRequest("GET", parsedURL.String(), nil)
+	if err != nil {
+		return 0, nil, NewSTSError(fmt.Sprintf("error creating request: %v", err))
+	}
+	req.Header.Set(v.clusterIDHeader(), clusterID)
+	req.Header.Set("accept", "application/json")
+
+	ctx := context.Background()
+	if v.queueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.queueTimeout)
+		defer cancel()
+	}
+	if err := v.limiter.acquire(ctx); err != nil {
+		return 0, nil, err
+	}
+	defer v.limiter.release()
+
+	start := time.Now()
+	response, err := v.clientFor(region).Do(req)
+	v.metricsRecorder().ObserveSTSLatency(time.Since(start))
+	if err != nil {
+		// special case to avoid printing the full URL if possible
+		if urlErr, ok := err.(*url.Error); ok {
+			return 0, nil, NewSTSError(fmt.Sprintf("error during GET: %v", urlErr.Err))
+		}
+		return 0, nil, NewSTSError(fmt.Sprintf("error during GET: %v", err))
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, nil, NewSTSError(fmt.Sprintf("error reading HTTP result: %v", err))
+	}
+	return response.StatusCode, responseBody, nil
+}
+
+// verifySignedHeaders checks that the pre-signed URL signs nothing but the
+// expected headers, each exactly once.
+func (v tokenVerifier) verifySignedHeaders(paramsLower *url.Values) error {
+	seen := map[string]bool{}
+	for _, hdr := range strings.Split(paramsLower.Get("x-amz-signedheaders"), ";") {
+		hdr = strings.ToLower(hdr)
+		if seen[hdr] {
+			return FormatError{message: fmt.Sprintf("signed header %q repeated in pre-signed URL", hdr)}
+		}
+		seen[hdr] = true
+		if !signedHeaderWhitelist[hdr] && hdr != v.clusterIDHeader() && !v.additionalSignedHeaders[hdr] {
+			return FormatError{message: fmt.Sprintf("unexpected signed header %q in pre-signed URL", hdr)}
+		}
+	}
+	return nil
+}
+
+// verifyGetRequest checks that the pre-signed URL was signed as a GET request
+// with SigV4 query parameters, and doesn't carry hints of a different method,
+// body or operation.
+func verifyGetRequest(paramsLower *url.Values) error {
+	for _, hdr := range strings.Split(paramsLower.Get("x-amz-signedheaders"), ";") {
+		if methodHintHeaders[strings.ToLower(hdr)] {
+			return FormatError{message: fmt.Sprintf("signed header %q is not valid for a GET request", hdr)}
+		}
+	}
+	if algorithm := paramsLower.Get("x-amz-algorithm"); algorithm != "" && algorithm != "AWS4-HMAC-SHA256" {
+		return FormatError{message: fmt.Sprintf("unexpected X-Amz-Algorithm %q in pre-signed URL", algorithm)}
+	}
+	if version := paramsLower.Get("version"); version != "" && version != "2011-06-15" {
+		return FormatError{message: fmt.Sprintf("unexpected version %q in pre-signed URL", version)}
+	}
+	// X-Amz-Credential is of the form <AccessKeyID>/<date>/<region>/sts/aws4_request
+	credential := strings.Split(paramsLower.Get("x-amz-credential"), "/")
+	if len(credential) == 5 && (credential[3] != "sts" || credential[4] != "aws4_request") {
+		return FormatError{message: fmt.Sprintf("unexpected credential scope %s/%s in pre-signed URL", credential[3], credential[4])}
+	}
+	return nil
+}
+
+func hasSignedClusterIDHeader(paramsLower *url.Values, header string) bool {
 	signedHeaders := strings.Split(paramsLower.Get("x-amz-signedheaders"), ";")
 	for _, hdr := range signedHeaders {
-		if strings.ToLower(hdr) == strings.ToLower(clusterIDHeader) {
+		if strings.ToLower(hdr) == strings.ToLower(header) {
 			return true
 		}
 	}
@@ -0,0 +1,70 @@
+/*
+Copyright 2017-2021 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// Keys of the extra user info populated by TokenReviewStatus.
+const (
+	ExtraCanonicalARN = "canonicalArn"
+	ExtraAccountID    = "accountId"
+	ExtraUserID       = "userId"
+	ExtraAccessKeyID  = "accessKeyId"
+	ExtraSessionName  = "sessionName"
+)
+
+// VerifyTokenReview verifies the token carried in a TokenReview spec with the
+// given Verifier and returns the status to send back to the API server. On
+// failure, the returned status is unauthenticated and carries the error.
+func VerifyTokenReview(v Verifier, token string) (authenticationv1.TokenReviewStatus, error) {
+	identity, err := v.Verify(token)
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{
+			Authenticated: false,
+			Error:         err.Error(),
+		}, err
+	}
+	return TokenReviewStatus(identity), nil
+}
+
+// TokenReviewStatus converts an Identity into an authenticated TokenReview
+// status. The username is the canonical ARN of the identity and the uid is
+// prefixed with the AWS account ID, matching the authenticator's webhook.
+func TokenReviewStatus(identity *Identity) authenticationv1.TokenReviewStatus {
+	extra := map[string]authenticationv1.ExtraValue{
+		ExtraCanonicalARN: {identity.CanonicalARN},
+		ExtraAccountID:    {identity.AccountID},
+		ExtraUserID:       {identity.UserID},
+		ExtraAccessKeyID:  {identity.AccessKeyID},
+	}
+	if identity.SessionName != "" {
+		extra[ExtraSessionName] = authenticationv1.ExtraValue{identity.SessionName}
+	}
+
+	return authenticationv1.TokenReviewStatus{
+		Authenticated: true,
+		User: authenticationv1.UserInfo{
+			Username: identity.CanonicalARN,
+			UID:      fmt.Sprintf("aws-iam-authenticator:%s:%s", identity.AccountID, identity.UserID),
+			Extra:    extra,
+		},
+	}
+}